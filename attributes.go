@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"os"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var keepPerm = os.FileMode(0)
+
+func parseKeepMode() error {
+	if keepMode == "" || keepMode == "permissive" {
+		return nil
+	}
+	mode, err := strconv.ParseUint(keepMode, 8, 32)
+	if err != nil || mode > uint64(os.ModePerm) {
+		return fmt.Errorf("'%s' is neither 'permissive' nor an octal mode", keepMode)
+	}
+	keepPerm = os.FileMode(mode)
+	return nil
+}
+
+func describeAttributes(f os.FileInfo) string {
+	if uid, gid, ok := fileOwner(f); ok {
+		return fmt.Sprintf("mode %s, owner %d:%d", f.Mode().Perm(), uid, gid)
+	}
+	return fmt.Sprintf("mode %s", f.Mode().Perm())
+}
+
+// attributesDiffer reports whether the members of a group have different
+// permission bits or owners.
+func attributesDiffer(g *DuplicateGroup) bool {
+	first := describeAttributes(g.files[0].file)
+	for _, file := range g.files[1:] {
+		if describeAttributes(file.file) != first {
+			return true
+		}
+	}
+	return false
+}
+
+// applyKeepMode moves the copy matching -keep-mode to the front of the
+// group, where it is the one kept by -delete, and warns when the members
+// of the group do not share the same permissions and owner.
+func applyKeepMode(g *DuplicateGroup) {
+	if !attributesDiffer(g) {
+		return
+	}
+	log.WithFields(log.Fields{
+		"hash":  g.hash,
+		"files": len(g.files),
+	}).Warn("Duplicate files have different permissions or owners")
+	if keepMode == "" {
+		return
+	}
+	best := 0
+	for i, file := range g.files {
+		perm := file.file.Mode().Perm()
+		if keepMode == "permissive" {
+			if bits.OnesCount32(uint32(perm)) > bits.OnesCount32(uint32(g.files[best].file.Mode().Perm())) {
+				best = i
+			}
+		} else if perm == keepPerm {
+			best = i
+			break
+		}
+	}
+	g.files[0], g.files[best] = g.files[best], g.files[0]
+}
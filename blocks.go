@@ -0,0 +1,27 @@
+package main
+
+import "io"
+
+// blockSplitter cuts files, disk images or block devices into fixed size
+// blocks, the last one being shorter when the size is not a multiple.
+type blockSplitter struct {
+	size int64
+}
+
+func (b blockSplitter) Split(r io.Reader, fn func(offset, length int64, content []byte)) error {
+	block := make([]byte, b.size)
+	var offset int64
+	for {
+		n, err := io.ReadFull(r, block)
+		if n > 0 {
+			fn(offset, int64(n), block[:n])
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cacheSkew the margin under which a modification time too close to the
+// cached scan is not trusted, covering coarse timestamps and clock drifts
+const cacheSkew = 2 * time.Second
+
+// cacheEntry the hash of a file along with the attributes it was taken with
+type cacheEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Hash    string    `json:"hash"`
+}
+
+// cacheFile the serialized form of a hashCache
+type cacheFile struct {
+	Scanned time.Time             `json:"scanned"`
+	Hashing string                `json:"hashing"`
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+// hashCache the hashes of a prior run, reused for the files that did not
+// change since that run started
+type hashCache struct {
+	sync.Mutex
+	path    string
+	scanned time.Time
+	started time.Time
+	entries map[string]cacheEntry
+	walked  map[string]bool
+	reused  int64
+}
+
+var cache *hashCache
+
+// hashingMode names how hashes are computed, since cached hashes can only
+// be reused by a run normalizing content the same way.
+func hashingMode() string {
+	mode := hashAlgorithm
+	if ignoreTrailingZeros {
+		mode += "+trailing-zeros"
+	}
+	if ignoreExif {
+		mode += "+exif"
+	}
+	if ignoreBOM {
+		mode += "+bom"
+	}
+	if ignoreWhitespace {
+		mode += "+whitespace"
+	}
+	return mode
+}
+
+// setHashingMode restores the hashing recorded by hashingMode, for the
+// hashes of an earlier run to be checked the way they were computed.
+func setHashingMode(mode string) error {
+	parts := strings.Split(mode, "+")
+	if _, ok := hashAlgorithms[parts[0]]; !ok {
+		return fmt.Errorf("unknown hashing '%s'", mode)
+	}
+	hashAlgorithm = parts[0]
+	ignoreTrailingZeros, ignoreExif, ignoreBOM, ignoreWhitespace = false, false, false, false
+	for _, part := range parts[1:] {
+		switch part {
+		case "trailing-zeros":
+			ignoreTrailingZeros = true
+		case "exif":
+			ignoreExif = true
+		case "bom":
+			ignoreBOM = true
+		case "whitespace":
+			ignoreWhitespace = true
+		default:
+			return fmt.Errorf("unknown hashing '%s'", mode)
+		}
+	}
+	return nil
+}
+
+// loadCache reads the cache at path, a missing file being an empty cache.
+// A cache written by a run hashing differently or dated in the future, the
+// clock having been set back since, is not trusted and starts over.
+func loadCache(path string) (*hashCache, error) {
+	c := &hashCache{path: path, started: time.Now(), entries: make(map[string]cacheEntry), walked: make(map[string]bool)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored cacheFile
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	if stored.Hashing != hashingMode() || stored.Scanned.After(c.started) {
+		return c, nil
+	}
+	c.scanned = stored.Scanned
+	if stored.Entries != nil {
+		c.entries = stored.Entries
+	}
+	return c, nil
+}
+
+// keep records files found by the walk, all at once or as -stream walks
+// them. When saved, the cache retains their entries and those of the files
+// still on disk that this run did not walk, under other roots or filtered
+// out, dropping those of deleted files.
+func (c *hashCache) keep(files ...*WalkedFile) {
+	c.Lock()
+	defer c.Unlock()
+	for _, file := range files {
+		c.walked[file.path()] = true
+	}
+}
+
+// lookup returns the cached hash of a file whose size and modification time
+// are unchanged, and which was last modified safely before the cached scan.
+func (c *hashCache) lookup(path string, f os.FileInfo) (string, bool) {
+	hash, ok := c.valid(path, f)
+	if ok {
+		atomic.AddInt64(&c.reused, 1)
+	}
+	return hash, ok
+}
+
+// valid returns the cached hash of a file as lookup does, without counting
+// it as reused
+func (c *hashCache) valid(path string, f os.FileInfo) (string, bool) {
+	c.Lock()
+	entry, ok := c.entries[path]
+	c.Unlock()
+	if !ok || entry.Size != f.Size() || !entry.ModTime.Equal(f.ModTime()) {
+		return "", false
+	}
+	if !f.ModTime().Before(c.scanned.Add(-cacheSkew)) {
+		return "", false
+	}
+	return entry.Hash, true
+}
+
+// cachedSizes returns the sizes shared with a file whose cached hash is
+// valid. The prefilter and the prehash read nothing of the files of these
+// sizes, leaving them all to the hashing, where the cached ones are not read
+// either: telling their first bytes apart would mean reading them.
+func cachedSizes(files []*WalkedFile) map[int64]bool {
+	if cache == nil {
+		return nil
+	}
+	sizes := make(map[int64]bool)
+	for _, file := range files {
+		if _, ok := cache.valid(file.path(), file.file); ok {
+			sizes[memberSize(file)] = true
+		}
+	}
+	return sizes
+}
+
+func (c *hashCache) store(path string, f os.FileInfo, hash string) {
+	c.Lock()
+	defer c.Unlock()
+	c.entries[path] = cacheEntry{Size: f.Size(), ModTime: f.ModTime(), Hash: hash}
+}
+
+// save atomically replaces the cache file, dated by the start of this run
+// so that files modified while it ran are hashed again next time.
+func (c *hashCache) save() error {
+	c.Lock()
+	stored := cacheFile{Scanned: c.started, Hashing: hashingMode(), Entries: make(map[string]cacheEntry, len(c.entries))}
+	for path, entry := range c.entries {
+		if c.walked[path] {
+			stored.Entries[path] = entry
+		} else if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			stored.Entries[path] = entry
+		}
+	}
+	c.Unlock()
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".duplicates-cache-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
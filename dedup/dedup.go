@@ -0,0 +1,215 @@
+// Package dedup finds duplicate files, the files of a set of directories
+// sharing the same content, without printing or acting on them.
+//
+//	finder := &dedup.Finder{MinSize: 1}
+//	groups, err := finder.Find(ctx, "/photos", "/backup/photos")
+//
+// Files are bucketed by size first, and only the files sharing a size are
+// hashed, by a Pool of workers. This is a subset of the duplicates command,
+// which scans with its own walk and options and may group files otherwise.
+package dedup
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// Group a set of files holding the same content
+type Group struct {
+	// Hash the hex encoded digest of the content
+	Hash string
+	// Size the size of each file, in bytes
+	Size int64
+	// Paths the files holding the content, sorted
+	Paths []string
+}
+
+// Finder the options of a search for duplicates. The zero value scans every
+// file, empty ones included, with md5 and one worker per CPU.
+type Finder struct {
+	// MinSize the minimum size of a file, inclusive
+	MinSize int64
+	// Name when set only keeps the files whose name matches
+	Name *regexp.Regexp
+	// Exclude globs matched against the path and the name of the walked
+	// files and directories, a matching directory being pruned
+	Exclude []string
+	// Workers the number of files hashed at once, runtime.NumCPU() when 0
+	Workers int
+	// NewHash builds the digest comparing files, md5 when nil
+	NewHash func() hash.Hash
+	// OnError when set is called with the files and directories that could
+	// not be read, which are otherwise skipped silently
+	OnError func(path string, err error)
+	// ShouldDelete, when set, is asked by RemoveCopies before any file is
+	// deleted, and by the duplicates command before any file is deleted,
+	// linked or moved. group holds every copy of the content, candidate
+	// the one about to be removed; returning false keeps the candidate.
+	ShouldDelete func(group []FileEntry, candidate FileEntry) bool
+}
+
+// candidate a walked file
+type candidate struct {
+	path string
+	info fs.FileInfo
+}
+
+// Find walks the roots and returns the groups of files sharing the same
+// content, largest files first. Hard links to the same file count as one
+// file. It stops with the error of the context when it is canceled, and
+// with the error of a root that can not be walked.
+func (f *Finder) Find(ctx context.Context, roots ...string) ([]Group, error) {
+	bySize := make(map[int64][]candidate)
+	for _, root := range roots {
+		if err := f.walk(ctx, root, bySize); err != nil {
+			return nil, err
+		}
+	}
+
+	var files []candidate
+	for _, bucket := range bySize {
+		if len(bucket) > 1 {
+			files = append(files, bucket...)
+		}
+	}
+	hashes, err := f.hashAll(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+
+	byHash := make(map[string][]candidate)
+	for i, file := range files {
+		if hashes[i] != "" {
+			byHash[hashes[i]] = append(byHash[hashes[i]], file)
+		}
+	}
+	var groups []Group
+	for sum, members := range byHash {
+		group := Group{Hash: sum, Size: members[0].info.Size()}
+	members:
+		for i, member := range members {
+			for _, earlier := range members[:i] {
+				if os.SameFile(earlier.info, member.info) {
+					continue members
+				}
+			}
+			group.Paths = append(group.Paths, member.path)
+		}
+		if len(group.Paths) > 1 {
+			sort.Strings(group.Paths)
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Size != groups[j].Size {
+			return groups[i].Size > groups[j].Size
+		}
+		return groups[i].Hash < groups[j].Hash
+	})
+	return groups, nil
+}
+
+// walk adds the regular files of a root passing the filters to bySize
+func (f *Finder) walk(ctx context.Context, root string, bySize map[int64][]candidate) error {
+	if _, err := os.Lstat(root); err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			f.failed(path, err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if Excluded(f.Exclude, path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || (f.Name != nil && !f.Name.MatchString(d.Name())) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			f.failed(path, err)
+			return nil
+		}
+		if info.Size() >= f.MinSize {
+			bySize[info.Size()] = append(bySize[info.Size()], candidate{path: path, info: info})
+		}
+		return nil
+	})
+}
+
+// Excluded reports whether a walked path matches one of the globs, either
+// as a whole or by its last element, so that "node_modules" prunes every
+// directory of that name and "/data/*/cache" a single level.
+func Excluded(patterns []string, path string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Finder) failed(path string, err error) {
+	if f.OnError != nil {
+		f.OnError(path, err)
+	}
+}
+
+// hashAll hashes the files with a pool of workers, the hash of a file that
+// could not be read being empty.
+func (f *Finder) hashAll(ctx context.Context, files []candidate) ([]string, error) {
+	newHash := f.NewHash
+	if newHash == nil {
+		newHash = md5.New
+	}
+	hashes := make([]string, len(files))
+	pool := NewPool(ctx, f.Workers, 1, newHash, func(_ int, hasher hash.Hash, i int) {
+		sum, err := hashFile(files[i].path, hasher)
+		if err != nil {
+			f.failed(files[i].path, err)
+			return
+		}
+		hashes[i] = sum
+	})
+	for i := range files {
+		if !pool.Send(i) {
+			break
+		}
+	}
+	return hashes, pool.Close()
+}
+
+func hashFile(path string, hasher hash.Hash) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher.Reset()
+	if _, err := io.Copy(hasher, bufio.NewReaderSize(file, 1024*1024)); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
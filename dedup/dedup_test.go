@@ -0,0 +1,161 @@
+package dedup
+
+import (
+	"context"
+	"hash"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// writeTree creates the files of a tree below dir, by path relative to it
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a/photo.jpg":      "large content",
+		"b/photo.jpg":      "large content",
+		"a/note.txt":       "small",
+		"b/note.txt":       "small",
+		"b/other.txt":      "other",
+		"a/empty":          "",
+		"b/empty":          "",
+		"cache/photo.jpg":  "large content",
+		"a/different.jpg":  "large cOntent",
+		"b/photo-link.jpg": "",
+	})
+	// a hard link is the same file as its target, not a duplicate of it
+	link := filepath.Join(dir, "b", "photo-link.jpg")
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(dir, "a", "photo.jpg"), link); err != nil {
+		t.Skip("hard links are not supported:", err)
+	}
+	in := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+		return paths
+	}
+
+	for _, tc := range []struct {
+		name   string
+		finder Finder
+		want   [][]string
+	}{
+		{"every file", Finder{Exclude: []string{"cache"}}, [][]string{
+			in("a/photo.jpg", "b/photo.jpg"),
+			in("a/note.txt", "b/note.txt"),
+			in("a/empty", "b/empty"),
+		}},
+		{"MinSize", Finder{MinSize: 6, Exclude: []string{"cache"}}, [][]string{
+			in("a/photo.jpg", "b/photo.jpg"),
+		}},
+		{"Name", Finder{Name: regexp.MustCompile(`\.txt$`)}, [][]string{
+			in("a/note.txt", "b/note.txt"),
+		}},
+		{"no exclusion", Finder{MinSize: 6}, [][]string{
+			in("a/photo.jpg", "b/photo.jpg", "cache/photo.jpg"),
+		}},
+	} {
+		finder := tc.finder
+		groups, err := finder.Find(context.Background(), dir)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		var got [][]string
+		for _, g := range groups {
+			got = append(got, g.Paths)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Find = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestFindCanceled(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a": "same", "b": "same"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	finder := &Finder{}
+	if _, err := finder.Find(ctx, dir); err != context.Canceled {
+		t.Errorf("Find with a canceled context = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestFindMissingRoot(t *testing.T) {
+	finder := &Finder{}
+	if _, err := finder.Find(context.Background(), filepath.Join(t.TempDir(), "missing")); !os.IsNotExist(err) {
+		t.Errorf("Find of a missing root = %v, want a not exist error", err)
+	}
+}
+
+func TestPool(t *testing.T) {
+	sums := make([]int, 100)
+	pool := NewPool(context.Background(), 4, 2, nil, func(worker int, _ hash.Hash, i int) {
+		if worker < 1 || worker > 4 {
+			t.Errorf("worker %d out of 1..4", worker)
+		}
+		sums[i] = i * i
+	})
+	for i := range sums {
+		if !pool.Send(i) {
+			t.Fatalf("Send(%d) refused by a running pool", i)
+		}
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i, sum := range sums {
+		if sum != i*i {
+			t.Fatalf("job %d was not done", i)
+		}
+	}
+}
+
+func TestRemoveCopies(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"kept": "same", "copy": "same", "protected/copy": "same"})
+	finder := &Finder{
+		ShouldDelete: func(group []FileEntry, candidate FileEntry) bool {
+			return filepath.Base(filepath.Dir(candidate.Path)) != "protected"
+		},
+	}
+	groups, err := finder.Find(context.Background(), dir)
+	if err != nil || len(groups) != 1 {
+		t.Fatalf("Find = %v, %v, want a single group", groups, err)
+	}
+	g := groups[0]
+	deleted, err := finder.RemoveCopies(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the paths are sorted, copy being kept
+	if want := []string{filepath.Join(dir, "kept")}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("RemoveCopies = %v, want %v", deleted, want)
+	}
+	for _, path := range g.Paths {
+		_, err := os.Lstat(path)
+		removed := os.IsNotExist(err)
+		if want := path != g.Paths[0] && filepath.Base(filepath.Dir(path)) != "protected"; removed != want {
+			t.Errorf("%s removed = %v, want %v", path, removed, want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package dedup
+
+import (
+	"os"
+	"time"
+)
+
+// FileEntry describes a copy of a group to a ShouldDelete hook
+type FileEntry struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Mode    os.FileMode
+}
+
+// Deletable reports whether the ShouldDelete hook, when set, lets candidate
+// be removed. group holds every copy of the content.
+func (f *Finder) Deletable(group []FileEntry, candidate FileEntry) bool {
+	return f.ShouldDelete == nil || f.ShouldDelete(group, candidate)
+}
+
+// RemoveCopies deletes the paths of a group but the first, which is kept,
+// apart from those the ShouldDelete hook refuses, and returns the paths
+// deleted. It stops at the first path that can not be read or deleted.
+func (f *Finder) RemoveCopies(g Group) ([]string, error) {
+	group := make([]FileEntry, len(g.Paths))
+	for i, path := range g.Paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return nil, err
+		}
+		group[i] = FileEntry{Path: path, Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode()}
+	}
+	var deleted []string
+	for _, candidate := range group[1:] {
+		if !f.Deletable(group, candidate) {
+			continue
+		}
+		if err := os.Remove(candidate.Path); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, candidate.Path)
+	}
+	return deleted, nil
+}
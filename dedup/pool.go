@@ -0,0 +1,86 @@
+package dedup
+
+import (
+	"context"
+	"hash"
+	"runtime"
+	"sync"
+)
+
+// Pool the workers hashing the jobs sent to it, each with its own hasher,
+// through a queue of a fixed length so that the memory does not grow with
+// the jobs waiting. Find hashes the files sharing a size with it.
+type Pool[T any] struct {
+	jobs   chan T
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// stopped is set by the workers leaving on a canceled context
+	mu      sync.Mutex
+	stopped error
+}
+
+// NewPool starts workers, runtime.NumCPU() when 0, calling work with their
+// number, from 1, their hasher, nil without newHash, and each job sent,
+// backlog jobs per worker waiting at most. The pool stops once ctx is
+// canceled, the workers being done with the jobs they were given.
+func NewPool[T any](ctx context.Context, workers, backlog int, newHash func() hash.Hash, work func(worker int, hasher hash.Hash, job T)) *Pool[T] {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Pool[T]{jobs: make(chan T, workers*backlog), ctx: ctx, cancel: cancel}
+	for w := 1; w <= workers; w++ {
+		p.wg.Add(1)
+		go func(id int) {
+			defer p.wg.Done()
+			var hasher hash.Hash
+			if newHash != nil {
+				hasher = newHash()
+			}
+			for {
+				select {
+				case <-ctx.Done():
+					p.stop(ctx.Err())
+					return
+				case job, ok := <-p.jobs:
+					if !ok {
+						return
+					}
+					work(id, hasher, job)
+				}
+			}
+		}(w)
+	}
+	return p
+}
+
+func (p *Pool[T]) stop(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped == nil {
+		p.stopped = err
+	}
+}
+
+// Send queues a job, waiting while the workers are busy, and reports false
+// once the pool was stopped.
+func (p *Pool[T]) Send(job T) bool {
+	select {
+	case p.jobs <- job:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// Close waits for the workers to be done with the jobs sent, and returns the
+// error of the context when it stopped them first.
+func (p *Pool[T]) Close() error {
+	close(p.jobs)
+	p.wg.Wait()
+	p.cancel()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopped
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var byDevice bool
+
+// deviceUsage the bytes reclaimable on a device
+type deviceUsage struct {
+	dev         uint64
+	known       bool
+	reclaimable int64
+}
+
+// reclaimableByDevice returns the bytes freed on each device by deleting the
+// copies, the first file of a group being kept and hard links to the same
+// inode counting once, most reclaimable first.
+func reclaimableByDevice(groups []*DuplicateGroup) []*deviceUsage {
+	byDev := make(map[uint64]*deviceUsage)
+	unknown := &deviceUsage{}
+	for _, g := range groups {
+		for _, file := range redundantCopies(g) {
+			dev, ok := fileDevice(file.file)
+			if !ok {
+				unknown.reclaimable += file.file.Size()
+				continue
+			}
+			if byDev[dev] == nil {
+				byDev[dev] = &deviceUsage{dev: dev, known: true}
+			}
+			byDev[dev].reclaimable += file.file.Size()
+		}
+	}
+	usages := make([]*deviceUsage, 0, len(byDev)+1)
+	for _, usage := range byDev {
+		usages = append(usages, usage)
+	}
+	if unknown.reclaimable > 0 {
+		usages = append(usages, unknown)
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].reclaimable > usages[j].reclaimable })
+	return usages
+}
+
+// mountPoints maps the devices to the directory they are mounted on, as
+// listed in /proc/self/mounts. It is empty where that file does not exist.
+// A device mounted several times is named by its shortest mount point.
+func mountPoints() map[uint64]string {
+	mounts := make(map[uint64]string)
+	file, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return mounts
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		dir := unescapeMount(fields[1])
+		info, err := os.Stat(dir)
+		if err != nil {
+			continue
+		}
+		dev, ok := fileDevice(info)
+		if !ok {
+			continue
+		}
+		if known, seen := mounts[dev]; !seen || len(dir) < len(known) {
+			mounts[dev] = dir
+		}
+	}
+	return mounts
+}
+
+// unescapeMount decodes the \NNN octal escapes used by the mount table for
+// spaces and other separators in paths.
+func unescapeMount(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func printDeviceSummary(groups []*DuplicateGroup) {
+	mounts := mountPoints()
+	for _, usage := range reclaimableByDevice(groups) {
+		switch mount, ok := mounts[usage.dev]; {
+		case !usage.known:
+			fmt.Fprintf(statsOutput, "Reclaimable on unknown devices: %s\n", formatSize(usage.reclaimable))
+		case ok:
+			fmt.Fprintf(statsOutput, "Reclaimable on %s (device %d): %s\n", mount, usage.dev, formatSize(usage.reclaimable))
+		default:
+			fmt.Fprintf(statsOutput, "Reclaimable on device %d: %s\n", usage.dev, formatSize(usage.reclaimable))
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// printDiff compares the groups of this run to those of a baseline report,
+// matched by hash, and prints the groups that appeared and disappeared. It
+// returns the number of new groups.
+func printDiff(baseline []jsonGroup, groups []*DuplicateGroup) int {
+	known := make(map[string]bool, len(baseline))
+	for _, g := range baseline {
+		known[g.Hash] = true
+	}
+	current := make(map[string]bool, len(groups))
+	added := 0
+	for _, g := range toJSONGroups(groups) {
+		current[g.Hash] = true
+		if known[g.Hash] {
+			continue
+		}
+		added++
+		printDiffGroup("Added", g)
+	}
+	removed := make([]jsonGroup, 0)
+	for _, g := range baseline {
+		if !current[g.Hash] {
+			removed = append(removed, g)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Hash < removed[j].Hash })
+	for _, g := range removed {
+		printDiffGroup("Removed", g)
+	}
+	if !noStats {
+		fmt.Fprintf(statsOutput, "\n%d groups added and %d removed since the baseline\n", added, len(removed))
+	}
+	return added
+}
+
+func printDiffGroup(change string, g jsonGroup) {
+	fmt.Fprintf(resultOutput, "%s %s (%s)\n", change, g.Hash, formatSize(g.Size))
+	for _, path := range g.Paths {
+		fmt.Fprintf(resultOutput, "%s\n", path)
+	}
+	fmt.Fprintln(resultOutput, "---------")
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// hashAlgorithm the -hash digest files are compared with
+var hashAlgorithm = "md5"
+
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"xxhash": func() hash.Hash { return xxhash.New() },
+}
+
+// hasherFactory resolves -hash into the constructor of its digest
+func hasherFactory() (func() hash.Hash, error) {
+	newHash, ok := hashAlgorithms[hashAlgorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash '%s' (md5, sha1, sha256, xxhash)", hashAlgorithm)
+	}
+	return newHash, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	dirsMode bool
+	// scannedDirs the directories walked in -dirs mode
+	scannedDirs []string
+)
+
+// dirGroup a set of directories holding the same files under the same names
+type dirGroup struct {
+	hash string
+	size int64
+	dirs []string
+	// outer the number of dirs not inside a directory reported elsewhere
+	outer int
+}
+
+// dirSummary the rolled up content of a walked directory
+type dirSummary struct {
+	entries []string
+	size    int64
+	partial bool
+}
+
+// collectDirGroups computes, from the deepest directories up, a hash for
+// each directory over the sorted names and hashes of its files and sub
+// directories, and returns the directories sharing the same hash. A
+// directory holding a file that could not be hashed, or any entry that is
+// not part of the scan, is never reported, nor its parents: files left out
+// by -size, -name, -ext, -ignore-empty or the exclusions would otherwise
+// make directories that differ look identical. Duplicates nested in
+// duplicate directories are left out, as acting on the outer directories
+// covers them.
+func collectDirGroups() []*dirGroup {
+	summaries := make(map[string]*dirSummary, len(scannedDirs))
+	for _, dir := range scannedDirs {
+		summaries[dir] = &dirSummary{}
+	}
+	hashed := make(map[*WalkedFile]string)
+	duplicates.RLock()
+	for hash, files := range duplicates.m {
+		for _, file := range files {
+			hashed[file] = hash
+		}
+	}
+	duplicates.RUnlock()
+	scanned := make(map[string]map[string]bool, len(scannedDirs))
+	for _, dir := range scannedDirs {
+		scanned[dir] = make(map[string]bool)
+	}
+	for _, dir := range scannedDirs {
+		if names := scanned[filepath.Dir(dir)]; names != nil && filepath.Dir(dir) != dir {
+			names[filepath.Base(dir)] = true
+		}
+	}
+	for _, file := range walkFiles {
+		if names := scanned[walkedDirs.dir(file.dir)]; names != nil {
+			names[file.file.Name()] = true
+		}
+	}
+	for dir, summary := range summaries {
+		summary.partial = !holdsOnly(dir, scanned[dir])
+	}
+	for _, file := range walkFiles {
+		summary := summaries[walkedDirs.dir(file.dir)]
+		if summary == nil {
+			continue
+		}
+		hash, ok := hashed[file]
+		if !ok {
+			summary.partial = true
+			continue
+		}
+		summary.entries = append(summary.entries, "f "+file.file.Name()+" "+hash)
+		summary.size += file.file.Size()
+	}
+
+	dirs := append([]string(nil), scannedDirs...)
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	hashes := make(map[string]string, len(dirs))
+	byHash := make(map[string]*dirGroup)
+	for _, dir := range dirs {
+		summary := summaries[dir]
+		sort.Strings(summary.entries)
+		hash := fmt.Sprintf("%x", md5.Sum([]byte(strings.Join(summary.entries, "\n"))))
+		parent := summaries[filepath.Dir(dir)]
+		if parent != nil && parent != summary {
+			parent.entries = append(parent.entries, "d "+filepath.Base(dir)+" "+hash)
+			parent.size += summary.size
+			parent.partial = parent.partial || summary.partial
+		}
+		if summary.partial || summary.size == 0 {
+			continue
+		}
+		hashes[dir] = hash
+		if byHash[hash] == nil {
+			byHash[hash] = &dirGroup{hash: hash, size: summary.size}
+		}
+		byHash[hash].dirs = append(byHash[hash].dirs, dir)
+	}
+
+	var groups []*dirGroup
+	for _, g := range byHash {
+		if len(g.dirs) < 2 {
+			continue
+		}
+		nested := true
+		for _, dir := range g.dirs {
+			if parent := hashes[filepath.Dir(dir)]; parent == "" || len(byHash[parent].dirs) < 2 {
+				nested = false
+				break
+			}
+		}
+		if !nested {
+			sort.Strings(g.dirs)
+			groups = append(groups, g)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].dirs[0] < groups[j].dirs[0] })
+	reported := make(map[string]bool)
+	for _, g := range groups {
+		for _, dir := range g.dirs {
+			reported[dir] = true
+		}
+	}
+	for _, g := range groups {
+		for _, dir := range g.dirs {
+			if !insideReported(dir, reported) {
+				g.outer++
+			}
+		}
+	}
+	return groups
+}
+
+// holdsOnly reports whether the entries of dir are all in names, the files
+// and directories the scan covered. A directory that can not be read is
+// taken as holding others.
+func holdsOnly(dir string, names map[string]bool) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if !names[entry.Name()] {
+			return false
+		}
+	}
+	return true
+}
+
+func insideReported(dir string, reported map[string]bool) bool {
+	for parent := filepath.Dir(dir); parent != dir; dir, parent = parent, filepath.Dir(parent) {
+		if reported[parent] {
+			return true
+		}
+	}
+	return false
+}
+
+func writeDirGroups(groups []*dirGroup) {
+	for _, g := range groups {
+		for _, dir := range g.dirs {
+			fmt.Fprintf(resultOutput, "%s\n", displayPath(dir))
+		}
+		fmt.Fprintf(resultOutput, "Size: %s\n", formatSize(g.size))
+		fmt.Fprintln(resultOutput, "---------")
+	}
+}
+
+func printDirSummary(root string, groups []*dirGroup) {
+	if noStats {
+		return
+	}
+	// copies inside a reported directory go away with it, and are not
+	// counted twice
+	var reclaimable int64
+	for _, g := range groups {
+		if g.outer > 1 {
+			reclaimable += int64(g.outer-1) * g.size
+		}
+	}
+	fmt.Fprintf(statsOutput, "\nFound %d duplicate directories from %d files in %s\nReclaimable in %s: %s\n", len(groups), fileCount, root, root, formatSize(reclaimable))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// doctorMode runs the preflight checks of the requested run, scanning as a
+// dry run, and reports them instead of acting on the duplicates
+var doctorMode bool
+
+// doctorCheck a preflight check and its outcome, nil when it passed
+type doctorCheck struct {
+	name string
+	err  error
+}
+
+var doctorChecks []doctorCheck
+
+// preflight handles the outcome of a check run before acting. With -doctor
+// it is recorded for the report and the run goes on; otherwise a failure
+// is reported with msg, a format taking the error, and the run stops.
+func preflight(name, msg string, err error) bool {
+	if doctorMode {
+		doctorChecks = append(doctorChecks, doctorCheck{name, err})
+		return err == nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, msg+"\n", err)
+		os.Exit(-1)
+	}
+	return true
+}
+
+// printDoctor lists the checks run by -doctor and returns how many failed
+func printDoctor() int {
+	failed := 0
+	fmt.Fprintln(resultOutput)
+	for _, check := range doctorChecks {
+		if check.err != nil {
+			failed++
+			fmt.Fprintf(resultOutput, "FAIL %s: %s\n", check.name, check.err)
+		} else {
+			fmt.Fprintf(resultOutput, "ok   %s\n", check.name)
+		}
+	}
+	fmt.Fprintf(resultOutput, "%d checks, %d failed\n", len(doctorChecks), failed)
+	return failed
+}
@@ -2,273 +2,1457 @@ package main
 
 import (
 	"bufio"
-	"context"
-	"crypto/md5"
+	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
-	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/unicode/norm"
 )
 
+// stringList a flag that can be repeated, accumulating its values
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 // WalkedFile a type of struct
 type WalkedFile struct {
-	path string
+	dir  int32
+	root int32
 	file os.FileInfo
+	// dev and ino identify the inode of the file, ino being 0 where the
+	// platform does not tell it
+	dev uint64
+	ino uint64
 }
 
 var (
-	singleThread  = false
-	delete        = false
-	visitCount    int64
-	fileCount     int64
-	dupCount      int64
-	minSize       int64
+	singleThread = false
+	deleteMode   = false
+	hardlinkMode = false
+	visitCount   int64
+	fileCount    int64
+	// scannedBytes the total size of the files counted by fileCount
+	scannedBytes int64
+	dupCount     int64
+	minSize      int64
+	// maxSize the largest size of a scanned file, inclusive, 0 for no limit
+	maxSize int64
+	// ignoreEmpty skips the empty files even with -size 0, since they all
+	// share the same hash
+	ignoreEmpty   = true
 	filenameMatch = "*"
 	filenameRegex *regexp.Regexp
-	duplicates    = struct {
+	// allowedExts and deniedExts the lower case extensions, without their
+	// dot, given to -ext and -not-ext
+	allowedExts map[string]bool
+	deniedExts  map[string]bool
+	// ignoreCase and normalizeUnicode fold the file names, and the -name
+	// and -regex patterns, to lower case and to Unicode NFC before they are
+	// matched
+	ignoreCase       bool
+	normalizeUnicode bool
+	duplicates       = struct {
 		sync.RWMutex
-		m map[string][]string
-	}{m: make(map[string][]string)}
+		m map[string][]*WalkedFile
+	}{m: make(map[string][]*WalkedFile)}
 	noStats      bool
 	walkProgress *Progress
-	walkFiles    []*WalkedFile
+	// stream hashes the walked files during the walk with -stream
+	stream          *hashStream
+	hashProgress    *Progress
+	walkFiles       []*WalkedFile
+	outputFormat              = "text"
+	statsOutput     io.Writer = os.Stdout
+	trimPrefix      string
+	absolutePath    bool
+	abbrevPaths     bool
+	findFile        string
+	findInfo        os.FileInfo
+	findHash        string
+	purgeHashes     map[string]bool
+	uniquesMode     bool
+	keepMode        string
+	ignoreCaseFS    bool
+	mixedExtensions bool
+	roots           []string
+	currentRoot     int32
+	ignoreSymlinks  bool
+	pathEncoding    = "utf8"
+	scanStart       time.Time
+	orderedReads    bool
+	// blockDevices makes block devices candidates, though their size is 0
+	blockDevices bool
+	// maxFiles stops the walk after this many candidates, when positive
+	maxFiles      int64
+	walkTruncated bool
+	errMaxFiles   = errors.New("maximum number of files reached")
+	// stopOnDeleteError stops the deletions at the first failure
+	stopOnDeleteError bool
+	// dryRun prints the deletions, links and moves instead of performing them
+	dryRun        bool
+	deletedFiles  int64
+	failedDeletes int64
+	// labeledDeletions is set while the listing labels the deletions itself
+	labeledDeletions bool
 )
 
-func scanAndHashFile(path string, f os.FileInfo, progress *Progress) {
-	// Early return if basic conditions are not met
-	if f.IsDir() || f.Size() <= minSize || (filenameMatch != "*" && !filenameRegex.MatchString(f.Name())) {
-		return
-	}
-
-	// Increment file count atomically
-	atomic.AddInt64(&fileCount, 1)
-
+// hashFile returns the hex encoded digest of the content of a file, computed
+// with hasher which is reset first. The bytes read are added to counter.
+func hashFile(path string, hasher hash.Hash, counter *byteCounter) (string, error) {
 	// Open the file
-	file, err := os.Open(path)
+	file, err := openFile(path)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"path":  path,
-			"error": err,
-		}).Error("Failed to open file")
-		return
+		return "", err
 	}
 	defer file.Close()
 
 	// Create a buffered reader for better performance
-	bufReader := bufio.NewReaderSize(file, 1024*1024) // 1MB buffer
-
-	// Calculate MD5 hash
-	md5Hash := md5.New()
-	if _, err := io.Copy(md5Hash, bufReader); err != nil {
-		log.WithFields(log.Fields{
-			"path":  path,
-			"error": err,
-		}).Error("Failed to calculate hash")
-		return
+	bufReader := bufio.NewReaderSize(counter.wrap(throttle(file)), 1024*1024) // 1MB buffer
+
+	// Calculate the digest
+	hasher.Reset()
+	if ignoreExif {
+		err := copyImageData(bufReader, file, normalizedWriter(hasher))
+		if err == nil {
+			return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+		}
+		if err != errNotImage {
+			log.WithFields(log.Fields{
+				"path":  path,
+				"error": err,
+			}).Debug("Unable to parse image, hashing the whole file")
+		}
+		// start over with the whole content
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		hasher.Reset()
+		bufReader.Reset(counter.wrap(throttle(file)))
+	}
+	if ignoreBOM {
+		if err := skipBOM(bufReader); err != nil {
+			return "", err
+		}
+	}
+	w := normalizedWriter(hasher)
+	if ignoreWhitespace && isText(bufReader) {
+		w = &whitespaceTrimWriter{w: w}
+	}
+	if _, err := io.Copy(w, bufReader); err != nil {
+		return "", err
+	}
+	if includeXattr {
+		if err := hashXattrs(hasher, path); err != nil {
+			return "", err
+		}
 	}
 
 	// Generate hash string
-	hash := fmt.Sprintf("%x", md5Hash.Sum(nil))
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// eligible reports whether a file is a regular file passing the -size,
+// -max-size, -ignore-empty and -name filters. Both sizes are inclusive: a
+// file of exactly -size or -max-size bytes is scanned. Named pipes, sockets
+// and devices are never scanned, reading a pipe blocking until it is written.
+func eligible(f os.FileInfo) bool {
+	return f.Mode().IsRegular() && f.Size() >= minSize && (maxSize == 0 || f.Size() <= maxSize) && (f.Size() > 0 || !ignoreEmpty) && nameMatches(f.Name())
+}
+
+// nameMatches reports whether a file name matches the -name glob, the -regex
+// regular expression and the -ext and -not-ext extensions, when they are
+// given. Extensions are compared case insensitively.
+func nameMatches(name string) bool {
+	name = foldName(name)
+	if filenameMatch != "*" {
+		if ok, _ := filepath.Match(filenameMatch, name); !ok {
+			return false
+		}
+	}
+	if allowedExts != nil || deniedExts != nil {
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+		if (allowedExts != nil && !allowedExts[ext]) || deniedExts[ext] {
+			return false
+		}
+	}
+	return filenameRegex == nil || filenameRegex.MatchString(name)
+}
+
+// foldName returns a file name, or a pattern, as the filters compare it:
+// lower cased with -ignore-case and NFC normalized with -normalize-unicode,
+// so that the NFD names of macOS match the NFC names of Linux.
+func foldName(name string) string {
+	if normalizeUnicode {
+		name = norm.NFC.String(name)
+	}
+	if ignoreCase {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// parseExtensions reads a comma separated list of extensions, with or
+// without their dot, as a set of lower case extensions
+func parseExtensions(list string) map[string]bool {
+	exts := make(map[string]bool)
+	for _, ext := range strings.Split(list, ",") {
+		if ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), ".")); ext != "" {
+			exts[ext] = true
+		}
+	}
+	return exts
+}
+
+// scanAndHashFile hashes a walked file into the duplicates map and returns
+// its hash, or an empty string when the file was skipped or unreadable.
+func scanAndHashFile(walked *WalkedFile, progress *Progress, hasher hash.Hash) string {
+	path, f := walked.path(), walked.file
+	counter := newByteCounter(progress, memberSize(walked))
+	defer counter.finish()
+	// Early return if basic conditions are not met
+	if !eligible(f) {
+		return ""
+	}
+
+	// Increment file count atomically
+	atomic.AddInt64(&fileCount, 1)
+	atomic.AddInt64(&scannedBytes, memberSize(walked))
+
+	hash, cached := "", false
+	if cache != nil {
+		hash, cached = cache.lookup(path, f)
+	}
+	if !cached {
+		var err error
+		hash, err = hashFile(path, hasher, counter)
+		if err != nil {
+			countFailure(path, err, "Failed to calculate hash")
+			return ""
+		}
+		if cache != nil {
+			cache.store(path, f, hash)
+		}
+	}
 
 	// Update duplicates map with proper locking
 	duplicates.Lock()
-	duplicates.m[hash] = append(duplicates.m[hash], path)
+	seen := len(duplicates.m[hash])
+	duplicates.m[hash] = append(duplicates.m[hash], walked)
 	duplicates.Unlock()
+	if seen > 0 {
+		atomic.AddInt64(&duplicateFiles, 1)
+		recordLiveDuplicate(seen == 1, f.Size())
+	} else {
+		atomic.AddInt64(&uniqueHashes, 1)
+	}
+
+	atomic.AddInt64(&hashedBytes, f.Size())
 
 	// Update progress
 	if progress != nil {
 		progress.increment()
 	}
+	return hash
 }
 
 type workerStats struct {
 	processedFiles int64
-	totalBytes    int64
-	errors        int64
+	totalBytes     int64
+	errors         int64
 }
 
-func worker(ctx context.Context, workerID int, jobs <-chan *WalkedFile, results chan<- error, progress *Progress) {
-	stats := &workerStats{}
-	defer func() {
-		log.WithFields(log.Fields{
-			"workerID":       workerID,
-			"processedFiles": stats.processedFiles,
-			"totalBytes":    stats.totalBytes,
-			"errors":        stats.errors,
-		}).Debug("Worker finished")
-	}()
-
-	for {
-		select {
-		case <-ctx.Done():
-			results <- ctx.Err()
-			return
-		case file, ok := <-jobs:
-			if !ok {
-				// Channel closed, worker can exit
-				results <- nil
-				return
-			}
+// hashWalkedFile hashes a file sent to a hash stream, adding it to the
+// statistics of its worker. The files it can not read are counted as
+// failures and skipped.
+func hashWalkedFile(file *WalkedFile, progress *Progress, hasher hash.Hash, stats *workerStats) {
+	// Skip invalid jobs, counted as failures
+	if file == nil || file.file == nil {
+		stats.errors++
+		path := ""
+		if file != nil {
+			path = file.path()
+		}
+		countFailure(path, errors.New("received invalid file data"), "Skipping file")
+		return
+	}
 
-			// Process the file
-			if file == nil || file.file == nil {
-				atomic.AddInt64(&stats.errors, 1)
-				results <- fmt.Errorf("received invalid file data")
-				continue
-			}
+	// Log file processing at debug level
+	log.WithFields(log.Fields{
+		"file": file.path(),
+		"size": file.file.Size(),
+	}).Debug("Processing file")
 
-			// Log file processing at debug level
-			log.WithFields(log.Fields{
-				"workerID": workerID,
-				"file":     file.path,
-				"size":     file.file.Size(),
-			}).Debug("Processing file")
+	// Process the file
+	hash := scanAndHashFile(file, progress, hasher)
+	markHashed(file)
+	if sink != nil {
+		sink.hashed(file, hash)
+	}
 
-			// Process the file
-			scanAndHashFile(file.path, file.file, progress)
+	// Update statistics
+	stats.processedFiles++
+	stats.totalBytes += file.file.Size()
+}
 
-			// Update statistics
-			atomic.AddInt64(&stats.processedFiles, 1)
-			atomic.AddInt64(&stats.totalBytes, file.file.Size())
+// hashingPattern the progress of the hashing phase, in bytes
+const hashingPattern = "Hashing %s of %s (%s) ..."
 
-			// Signal completion
-			results <- nil
-		}
+// candidateBytes sums the sizes of the files to hash
+func candidateBytes(files []*WalkedFile) int64 {
+	var total int64
+	for _, file := range files {
+		total += memberSize(file)
 	}
+	return total
 }
 
-func computeHashes() error {
-	// Create a context with cancellation
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
+func computeHashes(newHash func() hash.Hash) error {
 	// Initialize progress bar
-	walkProgress := creatProgress("Scanning %d files ...", &noStats)
-	defer walkProgress.delete()
-
-	// Create buffered channels for jobs and results
-	jobs := make(chan *WalkedFile, visitCount)
-	results := make(chan error, visitCount)
+	hashProgress = creatProgress("Scanning %d files ...", &hideProgress)
+	hashProgress.trackBytes(hashingPattern, candidateBytes(walkFiles))
+	hashProgress.details = hashDetails
+	defer hashProgress.delete()
+	defer startProgressEvents(hashProgress, "hash", int64(len(walkFiles)))()
 
-	// Calculate number of workers
-	numWorkers := 1
-	if !singleThread {
-		numWorkers = runtime.NumCPU()
+	if orderedReads {
+		sortByPath(walkFiles)
 	}
+	return hashFiles(walkFiles, hashProgress, newHash)
+}
 
-	// Start workers
-	log.WithField("workers", numWorkers).Info("Starting workers")
-	for w := 1; w <= numWorkers; w++ {
-		go worker(ctx, w, jobs, results, walkProgress)
+// hashFiles hashes files with a pool of workers, stopping when the scan is
+// interrupted, once the workers are done with the files they were reading.
+func hashFiles(files []*WalkedFile, progress *Progress, newHash func() hash.Hash) error {
+	s := startHashStream(progress, newHash)
+	for _, file := range files {
+		if !s.send(file) {
+			break
+		}
 	}
+	return s.close()
+}
 
-	// Send jobs to workers
-	go func() {
-		defer close(jobs)
-		for _, file := range walkFiles {
-			select {
-			case <-ctx.Done():
-				return
-			case jobs <- file:
-			}
+// sortByPath orders files by directory then name, so the files of a
+// directory are dispatched one after the other.
+func sortByPath(files []*WalkedFile) {
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := walkedDirs.dir(files[i].dir), walkedDirs.dir(files[j].dir)
+		if a != b {
+			return a < b
 		}
-	}()
+		return files[i].file.Name() < files[j].file.Name()
+	})
+}
 
-	// Collect results and handle errors
-	var firstErr error
-	for i := 0; i < len(walkFiles); i++ {
-		if err := <-results; err != nil {
-			if firstErr == nil {
-				firstErr = err
-				// Cancel context to stop other workers
-				cancel()
+func visitFile(path string, f os.FileInfo, err error) error {
+	atomic.AddInt64(&visitCount, 1)
+	if err != nil {
+		countFailure(path, err, "Failed to walk")
+		return nil
+	}
+	if ignoreCaseFS && seenFolded(path) {
+		log.WithField("path", path).Debug("Skipping path already walked with another casing")
+		if f.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	if (len(excludePatterns) > 0 && excluded(path)) || ignoredByFile(path, f.IsDir()) {
+		if f.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	if inReference(path, f) || (f.IsDir() && tooDeep(path)) {
+		return filepath.SkipDir
+	}
+	if f.IsDir() && !noIgnoreFiles {
+		loadIgnoreFile(path)
+	}
+	if f.Mode()&os.ModeSymlink != 0 {
+		// a root given as a link is walked as the directory it points to
+		if followSymlinks || path == roots[currentRoot] {
+			return visitSymlink(path)
+		}
+		return nil
+	}
+	if followSymlinks && f.IsDir() && !firstVisit(path, f) {
+		log.WithField("path", path).Debug("Skipping directory already walked through a symbolic link")
+		return filepath.SkipDir
+	}
+	if findInfo != nil && f.Size() != findInfo.Size() {
+		return nil
+	}
+	if dirsMode && f.IsDir() {
+		scannedDirs = append(scannedDirs, path)
+	}
+	if len(jdupesRules) > 0 && !f.IsDir() && !jdupesAllows(path, f) {
+		return nil
+	}
+	if interrupted() {
+		return errInterrupted
+	}
+	if eligible(f) || (blockDevices && f.Mode()&os.ModeDevice != 0 && f.Mode()&os.ModeCharDevice == 0) {
+		if maxFiles > 0 && int64(len(walkFiles)) >= maxFiles {
+			walkTruncated = true
+			return errMaxFiles
+		}
+		if stream != nil {
+			walked := newWalkedFile(path, f)
+			if cache != nil {
+				cache.keep(walked)
 			}
-			log.WithError(err).Error("Error processing file")
+			if !stream.send(walked) {
+				return errInterrupted
+			}
+		} else {
+			walkFiles = append(walkFiles, newWalkedFile(path, f))
 		}
+		walkProgress.increment()
 	}
+	return nil
+}
 
-	return firstErr
+// actionMode reports whether duplicates are acted upon rather than listed
+func actionMode() bool {
+	return deleteMode || hardlinkMode || moveTo != ""
 }
 
-func visitFile(path string, f os.FileInfo, err error) error {
-	visitCount++
-	if !f.IsDir() && f.Size() > minSize && (filenameMatch == "*" || filenameRegex.MatchString(f.Name())) {
-		walkFiles = append(walkFiles, &WalkedFile{path: path, file: f})
-		walkProgress.increment()
+// actOnDuplicate deletes, links or moves a redundant copy of the kept file,
+// and the other hard links to it, unless the ShouldDelete hook refuses it or
+// the deletions were stopped. It reports whether the copy was acted upon.
+func actOnDuplicate(g *DuplicateGroup, file *WalkedFile) bool {
+	if !actOnCopy(g, file) {
+		return false
 	}
-	return nil
+	for _, link := range g.links[file] {
+		actOnCopy(g, link)
+	}
+	return true
+}
+
+// actOnCopy deletes, links or moves a single path of a redundant copy
+func actOnCopy(g *DuplicateGroup, file *WalkedFile) bool {
+	kept := g.files[0]
+	if absPath(file.path()) == absPath(kept.path()) {
+		// the kept file itself, found twice
+		log.WithField("path", file.path()).Warn("Not acting on the kept copy listed twice")
+		return false
+	}
+	if vetoed(g.files, file) {
+		return false
+	}
+	if hardlinkMode {
+		return linkFile(kept, file)
+	}
+	if moveTo != "" {
+		moveFile(file)
+		return true
+	}
+	return deleteFile(file.path(), kept.path())
 }
 
-func deleteFile(path string) {
-	fmt.Println("Deleting " + path)
+// deletionsStopped reports whether a failed deletion stops the remaining ones
+func deletionsStopped() bool {
+	return stopOnDeleteError && failedDeletes > 0
+}
+
+// deleteFile removes a duplicate of kept, counting the deletions and
+// failures. It reports whether the deletion was attempted.
+func deleteFile(path, kept string) bool {
+	if deletionsStopped() {
+		return false
+	}
+	if dryRun {
+		if !labeledDeletions {
+			fmt.Fprintln(statsOutput, "Would delete "+path)
+		}
+		deletedFiles++
+		return true
+	}
+	if !labeledDeletions {
+		fmt.Fprintln(statsOutput, "Deleting "+path)
+	}
 	err := os.Remove(path)
 	if err != nil {
-		fmt.Printf("Error deleting file: %s \n", path)
+		failedDeletes++
+		fmt.Fprintf(statsOutput, "Error deleting file: %s \n", path)
+		if deletionsStopped() {
+			fmt.Fprintln(statsOutput, "Stopping the remaining deletions")
+		}
+		return true
+	}
+	deletedFiles++
+	if journal != nil {
+		journal.markDone(path)
+	}
+	if restore != nil {
+		restore.add(kept, path)
+	}
+	return true
+}
+
+// printDeletions reports the outcome of the deletions, if any was attempted
+func printDeletions() {
+	if dryRun && deletedFiles > 0 {
+		fmt.Fprintf(statsOutput, "Would delete %d files\n", deletedFiles)
+	} else if deletedFiles+failedDeletes > 0 {
+		fmt.Fprintf(statsOutput, "Deleted %d files, failed %d\n", deletedFiles, failedDeletes)
+	}
+}
+
+// takePurgeTargets removes from the scan every file whose hash is listed in
+// -delete-hashes and returns them as deletions to perform.
+func takePurgeTargets() []journalEntry {
+	duplicates.Lock()
+	defer duplicates.Unlock()
+	var targets []journalEntry
+	for hash, files := range duplicates.m {
+		if !purgeHashes[hash] {
+			continue
+		}
+		for _, file := range files {
+			if !vetoed(files, file) {
+				targets = append(targets, journalEntry{hash: hash, path: absPath(file.path())})
+			}
+		}
+		delete(duplicates.m, hash)
 	}
+	return targets
+}
+
+// printScanRate reports the files scanned and bytes hashed since the walk
+// started, with their rates over the elapsed wall time.
+func printScanRate() {
+	elapsed := time.Since(scanStart)
+	seconds := elapsed.Seconds()
+	files, bytes := atomic.LoadInt64(&fileCount), atomic.LoadInt64(&hashedBytes)
+	fmt.Fprintf(statsOutput, "\nScanned %d files in %s (%.0f files/s, %s/s)", files, elapsed.Round(time.Millisecond), float64(files)/seconds, formatSize(int64(float64(bytes)/seconds)))
+}
+
+func printSummary(root string, groups []*DuplicateGroup) {
+	if noStats {
+		return
+	}
+	printScanRate()
+	if walkTruncated {
+		fmt.Fprintf(statsOutput, "\nPartial results: the walk stopped after %d files (-max-files)", maxFiles)
+	}
+	if findInfo != nil {
+		copies := 0
+		if len(groups) > 0 {
+			copies = len(groups[0].files) - 1
+		}
+		fmt.Fprintf(statsOutput, "\nFound %d copies of '%s' from %d files in %s\n", copies, findFile, fileCount, root)
+		return
+	}
+	if uniquesMode {
+		fmt.Fprintf(statsOutput, "\nFound %d unique files from %d files in %s with options { size: '%d', name: '%s' }\n", len(groups), fileCount, root, minSize, filenameMatch)
+		return
+	}
+	fmt.Fprintf(statsOutput, "\nFound %d duplicates from %d files in %s with options { size: '%d', name: '%s' }\n", dupCount, fileCount, root, minSize, filenameMatch)
+	total, copies := totalReclaimable(groups)
+	printReclaimable(total, copies, reclaimableByRoot(groups))
+	if flagTruncated {
+		printTruncated()
+	}
+	if byDevice {
+		printDeviceSummary(groups)
+	}
+	printDeletions()
+	printFailures()
 }
 
 func main() {
-	flag.Int64Var(&minSize, "size", 1, "Minimum size in bytes for a file")
-	flag.StringVar(&filenameMatch, "name", "*", "Filename pattern")
+	flag.Int64Var(&minSize, "size", 1, "Minimum size in bytes for a file, inclusive")
+	flag.BoolVar(&ignoreEmpty, "ignore-empty", true, "Skip the empty files, which all share the same hash; with -ignore-empty=false and -size 0 they are listed as a labeled group")
+	flag.Int64Var(&maxSize, "max-size", 0, "Maximum size in bytes for a file, inclusive (0 for no limit)")
+	flag.StringVar(&filenameMatch, "name", "*", "Filename glob pattern, such as '*.jpg'")
+	nameRegex := flag.String("regex", "", "Regular expression file names must match, such as '\\.(jpe?g|png)$'")
+	flag.BoolVar(&ignoreCase, "ignore-case", false, "Match -name, -regex and -ext case insensitively")
+	flag.BoolVar(&normalizeUnicode, "normalize-unicode", false, "Normalize file names and -name and -regex to Unicode NFC before matching them")
+	extList := flag.String("ext", "", "Comma separated extensions of the files to scan, such as jpg,png,gif")
+	notExtList := flag.String("not-ext", "", "Comma separated extensions of the files to skip, such as tmp,log")
 	flag.BoolVar(&noStats, "nostats", false, "Do no output stats")
+	verbose := flag.Bool("verbose", false, "Log the debug messages of the walk, the workers and each file")
+	quiet := flag.Bool("quiet", false, "Only log errors")
 	flag.BoolVar(&singleThread, "singleThread", false, "Work on only one thread")
-	flag.BoolVar(&delete, "delete", false, "Delete duplicate files")
+	flag.IntVar(&workers, "workers", 0, "Number of files hashed at once (0 for one per CPU)")
+	flag.IntVar(&walkers, "walkers", 0, "Number of directories read at once by the walk (0 for one per CPU, 1 for a sequential walk in lexical order)")
+	flag.IntVar(&maxDepth, "max-depth", -1, "Levels of directories walked below each root (0 for the entries of the root only, -1 for no limit)")
+	flag.Int64Var(&maxFiles, "max-files", 0, "Stop the walk after this many candidate files, reporting partial results")
+	flag.Int64Var(&prehashBytes, "prehash-bytes", 4096, "Hash the first N bytes of same-size files before hashing fully the ones that still match (0 disables)")
+	flag.BoolVar(&interactive, "interactive", false, "With -delete, ask for each group which copies to keep")
+	flag.BoolVar(&perceptual, "perceptual", false, "Also list the jpg, png and gif images that look alike, resized or encoded again, as near-duplicates")
+	flag.IntVar(&perceptualDistance, "perceptual-distance", 5, "Largest number of bits, out of 64, two near-duplicate images' hashes differ by")
+	flag.BoolVar(&streamFiles, "stream", false, "Hash the files while the walk finds them, without holding the list of all the candidates")
+	flag.BoolVar(&lowMemory, "low-memory", false, "Hash and report the files one size at a time, holding the hashes of a single size in memory")
+	flag.BoolVar(&orderedReads, "ordered-reads", false, "Hash the files in directory order rather than grouped by size, for spinning disks")
+	flag.BoolVar(&deleteMode, "delete", false, "Delete duplicate files")
+	flag.BoolVar(&hardlinkMode, "hardlink", false, "Replace duplicate files with hard links to the kept copy")
+	flag.BoolVar(&doctorMode, "doctor", false, "Run the preflight checks of the given options, scanning as a dry run, and report them instead of acting")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the files -delete, -hardlink, -move-to and -delete-hashes would act on, without touching them")
+	flag.BoolVar(&stopOnDeleteError, "stop-on-delete-error", false, "Stop the remaining deletions as soon as one fails")
+	flag.StringVar(&moveTo, "move-to", "", "Move duplicate files into this directory, keeping their path relative to the scanned root")
+	flag.StringVar(&tempDir, "tmpdir", "", "Directory for intermediate files, on the same file system as the scanned tree, or as the -move-to directory with -move-to (default: next to each file)")
+	flag.StringVar(&hashAlgorithm, "hash", "md5", "Digest used to compare files (md5, sha1, sha256, xxhash)")
+	flag.BoolVar(&verifyContent, "verify", false, "Compare the bytes of the files sharing a hash, splitting the groups that differ and counting hash collisions")
+	flag.StringVar(&sizeUnits, "units", "binary", "Units of the sizes displayed and of the KB, MB... given to flags (binary for 1024, si for 1000)")
+	summaryPath := flag.String("summary-json", "", "Write the totals of the scan to this file as JSON")
+	outputPath := flag.String("output", "", "Write the results to this file instead of stdout, the stats and progress going to stderr")
+	flag.IntVar(&minCopies, "min-copies", 2, "Only report the groups of at least this many copies")
+	flag.StringVar(&groupOrder, "sort", "path", "Order of the groups: path, by their first path, or size, largest first")
+	flag.StringVar(&outputFormat, "format", "text", "Output format (text, json, csv, dot)")
+	flag.StringVar(&trimPrefix, "trim-prefix", "", "Strip this prefix from displayed paths ('auto' strips the longest common directory)")
+	flag.BoolVar(&abbrevPaths, "abbrev", false, "Shorten the paths of each group to the last components telling them apart")
+	flag.BoolVar(&absolutePath, "absolute", false, "Display absolute paths, ignoring -trim-prefix")
+	flag.StringVar(&pathEncoding, "path-encoding", "utf8", "Encoding of displayed paths (utf8, ascii-escape, percent)")
+	flag.StringVar(&findFile, "find", "", "Only report the copies of this file")
+	flag.BoolVar(&uniquesMode, "uniques", false, "Report files that have no duplicate instead")
+	flag.StringVar(&keepStrategy, "keep", "first", "Copy kept in each group by the action modes (first, oldest, newest, shortest-path, random)")
+	flag.Int64Var(&keepSeed, "seed", 0, "Seed of -keep random, for reproducible runs (default: drawn from the clock)")
+	flag.StringVar(&keepMode, "keep-mode", "", "When deleting, keep the copy with the most permissive mode ('permissive') or with this octal mode")
+	referencePath := flag.String("reference", "", "Only report the files that have a copy under this directory, which is walked apart from the scanned roots")
+	boundarySpec := flag.String("boundary", "", "Only report groups with copies under both of these comma separated paths (A,B)")
+	recentGroups := flag.Int("recent", 0, "Only report the N groups with the most recently modified files")
+	oldestGroups := flag.Int("oldest", 0, "Only report the N groups with the oldest files")
+	flag.BoolVar(&byDevice, "by-device", false, "Summarize the reclaimable space per device, named by its mount point")
+	flag.BoolVar(&dirsMode, "dirs", false, "Report directories whose files and sub directories are all identical instead")
+	flag.BoolVar(&flagTruncated, "flag-truncated", false, "Separate the members of a group whose size differs from the majority as suspected truncated or corrupt copies, never acted upon")
+	flag.BoolVar(&mixedExtensions, "mixed-ext", false, "Only report groups whose copies have different extensions")
+	flag.BoolVar(&ignoreTrailingZeros, "ignore-trailing-zeros", false, "Ignore the zero bytes padding the end of files (approximate)")
+	flag.BoolVar(&tailFirst, "tail-first", false, "Prefilter same-size files on their end rather than their start (append-heavy files)")
+	flag.BoolVar(&includeXattr, "include-xattr", false, "Make the extended attributes of files part of their content (Linux, macOS)")
+	flag.BoolVar(&ignoreWhitespace, "ignore-whitespace", false, "Ignore the whitespace ending the lines and the blank lines ending text files (approximate)")
+	flag.BoolVar(&ignoreBOM, "ignore-bom", false, "Ignore the UTF-8 or UTF-16 byte order mark starting text files (approximate)")
+	flag.BoolVar(&ignoreExif, "ignore-exif", false, "Only hash the image data of JPEG and TIFF files, ignoring their metadata (approximate)")
+	flag.BoolVar(&niceMode, "nice", false, "Pause hashing while the system load is above the number of CPUs")
+	readRate := flag.String("rate", "", "Limit the bytes read per second by all workers (e.g. 50MB/s)")
+	maxReadMBps := flag.Int64("max-read-mbps", 0, "Limit the megabytes (1000000 bytes) read per second by all workers, 0 for no limit")
+	flag.BoolVar(&ignoreSymlinks, "ignore-symlinks", false, "Skip symbolic links to files and directories, the default unless -follow-symlinks")
+	flag.BoolVar(&followSymlinks, "follow-symlinks", false, "Walk the targets of symbolic links, each directory once, instead of skipping the links")
+	flag.BoolVar(&ignoreCaseFS, "ignore-case-fs", false, "Treat paths differing only by case as the same file")
+	liveSummary := flag.Duration("live-summary", 0, "Periodically summarize the duplicate groups found while hashing (e.g. 5s)")
+	flag.StringVar(&progressFormat, "progress-format", "text", "Progress format (text, json for NDJSON events on stderr)")
+	flag.DurationVar(&progressInterval, "progress-interval", time.Second, "Interval between two json progress events")
+	sinkPath := flag.String("sink", "", "Stream each duplicate group as NDJSON to this Unix socket or named pipe once it is complete")
+	serveAddr := flag.String("serve", "", "Serve the scan status and results over HTTP on this address")
+	var protected stringList
+	flag.Var(&excludePatterns, "exclude", "Skip the files and directories whose path or name matches this glob, pruning whole directories (repeatable)")
+	flag.BoolVar(&noIgnoreFiles, "no-ignore-files", false, "Do not read the .duplicatesignore files of the walked directories")
+	flag.Var(&protected, "protect", "Never delete or link files under this directory (repeatable)")
+	keySpec := flag.String("key", "content", "Comma separated components files must all share to be duplicates (content, size, ext, name, dir)")
+	blockDedup := flag.Bool("block-dedup", false, "Find duplicate fixed size blocks inside files, disk images and block devices instead of duplicate files")
+	blockSize := flag.String("block-size", "4KB", "Size of the blocks compared by -block-dedup")
+	recordsMode := flag.String("records", "", "Find duplicate records inside files instead of duplicate files (mbox)")
+	cachePath := flag.String("cache", "", "Reuse the hashes of files unchanged since the run that wrote this cache, then update it")
+	restorePath := flag.String("restore-script", "", "Write a shell script recreating the deleted duplicates from the kept copies")
+	journalPath := flag.String("journal", "", "Write planned deletions to this journal before performing them")
+	diffPath := flag.String("diff", "", "Print the groups added and removed since this baseline JSON report, failing when groups were added")
+	trendReports := flag.String("trend", "", "Comma separated JSON reports of prior runs to compare, oldest first, then exit")
+	resumePath := flag.String("resume-journal", "", "Resume the pending deletions of a journal, then exit")
+	jdupesExclude := flag.String("jdupes-exclude", "", "File of jdupes -X filters (size, nostr, onlystr, noext, onlyext) applied to the walk")
+	goldenPath := flag.String("golden", "", "File listing approved content hashes, to report the files that do not match them")
+	manifestURL := flag.String("manifest-url", "", "URL of a manifest of approved content hashes, used like -golden")
+	manifestCachePath := flag.String("manifest-cache", "", "Keep the -manifest-url manifest in this file, fetching it again only when its ETag changed")
+	flag.StringVar(&goldenReport, "golden-report", "unknown", "Files reported by -golden (unknown, approved)")
+	deleteHashes := flag.String("delete-hashes", "", "File listing content hashes whose files are always deleted")
 	var help = flag.Bool("h", false, "Display this message")
 	flag.Parse()
 	if *help {
 		fmt.Println("duplicates is a command line tool to find duplicate files in a folder")
-		fmt.Println("usage: duplicates [options...] path")
+		fmt.Println("usage: duplicates [options...] path [path...]")
 		flag.PrintDefaults()
 		os.Exit(0)
 	}
+	switch {
+	case *verbose && *quiet:
+		fmt.Fprintf(os.Stderr, "-verbose and -quiet can not be used together\n")
+		os.Exit(-1)
+	case *verbose:
+		log.SetLevel(log.DebugLevel)
+	case *quiet:
+		log.SetLevel(log.ErrorLevel)
+	}
+	handleInterrupts()
+	newHash, err := hasherFactory()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -hash: %s\n", err)
+		os.Exit(-1)
+	}
+	if *trendReports != "" {
+		if err := printTrend(strings.Split(*trendReports, ",")); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to compute the trend: %s\n", err)
+			os.Exit(-1)
+		}
+		os.Exit(0)
+	}
+	if *resumePath != "" {
+		skipped, err := resumeJournal(*resumePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to resume the deletion journal: %s\n", err)
+			os.Exit(-1)
+		}
+		if skipped > 0 {
+			os.Exit(exitIncomplete)
+		}
+		os.Exit(0)
+	}
 	if len(flag.Args()) < 1 {
 		fmt.Fprintf(os.Stderr, "You have to specify at least a directory to explore ...\n")
 		os.Exit(-1)
 	}
-	root := flag.Arg(0)
-	walkProgress = creatProgress("Walking through %d files ...", &noStats)
-	if !noStats {
-		fmt.Printf("\nSearching duplicates in '%s' with name that match '%s' and minimum size '%d' bytes\n\n", root, filenameMatch, minSize)
+	if sizeUnits != "binary" && sizeUnits != "si" {
+		fmt.Fprintf(os.Stderr, "Unknown units '%s'\n", sizeUnits)
+		os.Exit(-1)
 	}
-	r, _ := regexp.Compile(filenameMatch)
-	filenameRegex = r
-	err := filepath.Walk(root, visitFile)
-	if err != nil {
-		log.Errorln(err)
+	if minCopies < 2 {
+		fmt.Fprintf(os.Stderr, "-min-copies must be at least 2\n")
+		os.Exit(-1)
+	}
+	if minCopies > 2 && (uniquesMode || dirsMode || *recordsMode != "" || *blockDedup) {
+		fmt.Fprintf(os.Stderr, "-min-copies only applies to duplicate files\n")
+		os.Exit(-1)
+	}
+	if ignoreSymlinks && followSymlinks {
+		fmt.Fprintf(os.Stderr, "-ignore-symlinks and -follow-symlinks can not be used together\n")
+		os.Exit(-1)
+	}
+	if groupOrder != "path" && groupOrder != "size" {
+		fmt.Fprintf(os.Stderr, "Unknown sort order '%s' (path, size)\n", groupOrder)
+		os.Exit(-1)
+	}
+	switch outputFormat {
+	case "text":
+	case "dot", "json", "csv":
+		statsOutput = os.Stderr
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown output format '%s'\n", outputFormat)
+		os.Exit(-1)
+	}
+	if *recentGroups > 0 && *oldestGroups > 0 {
+		fmt.Fprintf(os.Stderr, "-recent and -oldest can not be used together\n")
+		os.Exit(-1)
+	}
+	var boundary []string
+	if *boundarySpec != "" {
+		boundary = strings.Split(*boundarySpec, ",")
+		if len(boundary) != 2 || boundary[0] == "" || boundary[1] == "" {
+			fmt.Fprintf(os.Stderr, "-boundary expects two comma separated paths\n")
+			os.Exit(-1)
+		}
+		for i, path := range boundary {
+			if abs, err := filepath.Abs(path); err == nil {
+				boundary[i] = abs
+			}
+		}
+	}
+	var splitter RecordSplitter
+	if *blockDedup {
+		size, err := parseSize(*blockSize)
+		if err != nil || size <= 0 {
+			fmt.Fprintf(os.Stderr, "Invalid -block-size '%s'\n", *blockSize)
+			os.Exit(-1)
+		}
+		if *recordsMode != "" {
+			fmt.Fprintf(os.Stderr, "-block-dedup and -records can not be used together\n")
+			os.Exit(-1)
+		}
+		splitter = blockSplitter{size: size}
+		blockDevices = true
+	}
+	if splitter != nil || *recordsMode != "" {
+		if splitter == nil {
+			if splitter = recordSplitters[*recordsMode]; splitter == nil {
+				fmt.Fprintf(os.Stderr, "Unknown record format '%s'\n", *recordsMode)
+				os.Exit(-1)
+			}
+		}
+		if actionMode() || outputFormat != "text" || uniquesMode || findFile != "" {
+			fmt.Fprintf(os.Stderr, "-records and -block-dedup only report duplicate records as text\n")
+			os.Exit(-1)
+		}
+	}
+	if err := parseKey(*keySpec); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -key: %s\n", err)
+		os.Exit(-1)
+	}
+	if len(groupKey) > 1 || !keyed("content") {
+		if uniquesMode || findFile != "" || dirsMode || *recordsMode != "" || *sinkPath != "" {
+			fmt.Fprintf(os.Stderr, "-key can only be used to report duplicate files\n")
+			os.Exit(-1)
+		}
+	}
+	if actionMode() && !keyed("content") {
+		fmt.Fprintf(os.Stderr, "-delete, -hardlink and -move-to need content in -key\n")
+		os.Exit(-1)
+	}
+	if dirsMode && (actionMode() || *deleteHashes != "" || outputFormat != "text" || uniquesMode || findFile != "" || maxFiles > 0) {
+		fmt.Fprintf(os.Stderr, "-dirs only reports duplicate directories as text\n")
+		os.Exit(-1)
+	}
+	if lowMemory && (actionMode() || outputFormat != "text" || uniquesMode || findFile != "" || dirsMode || !keyed("content") || len(groupKey) > 1 ||
+		approximateHashing() || *sinkPath != "" || *diffPath != "" || *goldenPath != "" || *manifestURL != "" || *deleteHashes != "" ||
+		*boundarySpec != "" || *recentGroups > 0 || *oldestGroups > 0 || byDevice) {
+		fmt.Fprintf(os.Stderr, "-low-memory only reports exact duplicate files as text\n")
+		os.Exit(-1)
 	}
+	if interactive {
+		if !deleteMode || outputFormat != "text" || *outputPath != "" || *journalPath != "" || uniquesMode {
+			fmt.Fprintf(os.Stderr, "-interactive needs -delete and the text listing on the terminal, without -journal\n")
+			os.Exit(-1)
+		}
+		if err := checkInteractive(); err != nil {
+			fmt.Fprintf(os.Stderr, "-interactive needs a terminal: %s\n", err)
+			os.Exit(-1)
+		}
+	}
+	if *referencePath != "" && (actionMode() || outputFormat != "text" || lowMemory || uniquesMode || findFile != "" || dirsMode || perceptual ||
+		*goldenPath != "" || *manifestURL != "" || *recordsMode != "" || *blockDedup || *deleteHashes != "" || *diffPath != "" || *summaryPath != "") {
+		fmt.Fprintf(os.Stderr, "-reference only lists the files duplicating the reference as text\n")
+		os.Exit(-1)
+	}
+	if perceptual && (actionMode() || outputFormat != "text" || lowMemory || streamFiles || uniquesMode || findFile != "" || dirsMode ||
+		*goldenPath != "" || *manifestURL != "" || *recordsMode != "" || *blockDedup || *deleteHashes != "" || *diffPath != "") {
+		fmt.Fprintf(os.Stderr, "-perceptual only lists near-duplicate images as text, next to the duplicate files\n")
+		os.Exit(-1)
+	}
+	if perceptualDistance < 0 || perceptualDistance > 64 {
+		fmt.Fprintf(os.Stderr, "-perceptual-distance must be between 0 and 64\n")
+		os.Exit(-1)
+	}
+	if streamFiles && (lowMemory || orderedReads || maxFiles > 0 || dirsMode || uniquesMode || *goldenPath != "" || *manifestURL != "" ||
+		*sinkPath != "" || *recordsMode != "" || *blockDedup || !keyed("content") || len(groupKey) > 1) {
+		fmt.Fprintf(os.Stderr, "-stream hashes the files as they are found and only reports duplicate files by content\n")
+		os.Exit(-1)
+	}
+	if lowMemory && groupOrder == "size" {
+		fmt.Fprintf(os.Stderr, "-low-memory writes the groups from the smallest files and can not -sort by size\n")
+		os.Exit(-1)
+	}
+	var baseline []jsonGroup
+	if *diffPath != "" {
+		if actionMode() || outputFormat != "text" || uniquesMode {
+			fmt.Fprintf(os.Stderr, "-diff only reports duplicate groups as text\n")
+			os.Exit(-1)
+		}
+		var err error
+		if baseline, err = readReport(*diffPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read the baseline: %s\n", err)
+			os.Exit(-1)
+		}
+	}
+	if len(protected) > 0 {
+		protectPaths(protected)
+	}
+	if uniquesMode && findFile != "" {
+		fmt.Fprintf(os.Stderr, "-uniques and -find can not be used together\n")
+		os.Exit(-1)
+	}
+	if pathEncoding != "utf8" && pathEncoding != "ascii-escape" && pathEncoding != "percent" {
+		fmt.Fprintf(os.Stderr, "Unknown path encoding '%s'\n", pathEncoding)
+		os.Exit(-1)
+	}
+	if progressFormat != "text" && progressFormat != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown progress format '%s'\n", progressFormat)
+		os.Exit(-1)
+	}
+	if (deleteMode && hardlinkMode) || (moveTo != "" && (deleteMode || hardlinkMode)) {
+		fmt.Fprintf(os.Stderr, "-delete, -hardlink and -move-to can not be used together\n")
+		os.Exit(-1)
+	}
+	if actionMode() && approximateHashing() && !verifyContent {
+		fmt.Fprintf(os.Stderr, "-delete, -hardlink and -move-to need -verify when files with different content may be grouped\n")
+		os.Exit(-1)
+	}
+	if *readRate != "" {
+		if err := setReadRate(*readRate); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -rate: %s\n", err)
+			os.Exit(-1)
+		}
+	}
+	if *maxReadMBps < 0 {
+		fmt.Fprintf(os.Stderr, "-max-read-mbps can not be negative\n")
+		os.Exit(-1)
+	}
+	if *maxReadMBps > 0 {
+		if *readRate != "" {
+			fmt.Fprintf(os.Stderr, "-rate and -max-read-mbps can not be used together\n")
+			os.Exit(-1)
+		}
+		setReadLimit(*maxReadMBps * 1000 * 1000)
+	}
+	filenameMatch = foldName(filenameMatch)
+	if _, err := filepath.Match(filenameMatch, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -name '%s': %s\n", filenameMatch, err)
+		os.Exit(-1)
+	}
+	if *nameRegex != "" {
+		expr := *nameRegex
+		if normalizeUnicode {
+			expr = norm.NFC.String(expr)
+		}
+		if ignoreCase {
+			expr = "(?i)" + expr
+		}
+		r, err := regexp.Compile(expr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -regex: %s\n", err)
+			os.Exit(-1)
+		}
+		filenameRegex = r
+	}
+	if *extList != "" {
+		if allowedExts = parseExtensions(*extList); len(allowedExts) == 0 {
+			fmt.Fprintf(os.Stderr, "Invalid -ext '%s'\n", *extList)
+			os.Exit(-1)
+		}
+	}
+	if *notExtList != "" {
+		deniedExts = parseExtensions(*notExtList)
+	}
+	if maxSize < 0 || (maxSize > 0 && maxSize < minSize) {
+		fmt.Fprintf(os.Stderr, "-max-size must be 0 or at least -size\n")
+		os.Exit(-1)
+	}
+	if dryRun && !actionMode() && *deleteHashes == "" {
+		fmt.Fprintf(os.Stderr, "-dry-run needs -delete, -hardlink, -move-to or -delete-hashes\n")
+		os.Exit(-1)
+	}
+	if doctorMode {
+		if lowMemory || uniquesMode || findFile != "" || dirsMode || interactive || *goldenPath != "" || *manifestURL != "" ||
+			*recordsMode != "" || *blockDedup || *diffPath != "" || *referencePath != "" || outputFormat != "text" {
+			fmt.Fprintf(os.Stderr, "-doctor checks the duplicate file listing and its actions, as text\n")
+			os.Exit(-1)
+		}
+		// the checks scan as a dry run, touching no file
+		dryRun = true
+	}
+	if workers < 0 {
+		fmt.Fprintf(os.Stderr, "-workers can not be negative\n")
+		os.Exit(-1)
+	}
+	if singleThread && workers > 1 {
+		fmt.Fprintf(os.Stderr, "-singleThread and -workers %d can not be used together\n", workers)
+		os.Exit(-1)
+	}
+	if walkers < 0 {
+		fmt.Fprintf(os.Stderr, "-walkers can not be negative\n")
+		os.Exit(-1)
+	}
+	if maxDepth < -1 {
+		fmt.Fprintf(os.Stderr, "-max-depth must be -1 for no limit, or 0 or more\n")
+		os.Exit(-1)
+	}
+	if singleThread && walkers > 1 {
+		fmt.Fprintf(os.Stderr, "-singleThread and -walkers %d can not be used together\n", walkers)
+		os.Exit(-1)
+	}
+	if prehashBytes < 0 {
+		fmt.Fprintf(os.Stderr, "-prehash-bytes can not be negative\n")
+		os.Exit(-1)
+	}
+	if err := parseKeepStrategy(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -keep: %s\n", err)
+		os.Exit(-1)
+	}
+	seeded := false
+	flag.Visit(func(f *flag.Flag) { seeded = seeded || f.Name == "seed" })
+	if !seeded {
+		keepSeed = time.Now().UnixNano()
+	}
+	if err := parseKeepMode(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -keep-mode: %s\n", err)
+		os.Exit(-1)
+	}
+	var rootKeys []string
+	for _, arg := range flag.Args() {
+		if !preflight("root "+arg+" readable", "Unable to scan: %s", checkRoot(arg)) {
+			continue
+		}
+		if ignoreCaseFS {
+			arg = canonicalCase(arg)
+		}
+		key := arg
+		if abs, err := filepath.Abs(arg); err == nil {
+			key = abs
+		}
+		roots, rootKeys = append(roots, arg), append(rootKeys, key)
+	}
+	roots, rootKeys = outermostRoots(roots, rootKeys)
+	// root names the scanned roots in the summaries
+	root := strings.Join(roots, ", ")
+	if *referencePath != "" {
+		if err := checkRoot(*referencePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to scan the reference: %s\n", err)
+			os.Exit(-1)
+		}
+		if referenceDir, err = filepath.Abs(*referencePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to scan the reference: %s\n", err)
+			os.Exit(-1)
+		}
+		for _, key := range rootKeys {
+			if underPath(key, referenceDir) {
+				fmt.Fprintf(os.Stderr, "-reference can not hold the scanned root %s\n", key)
+				os.Exit(-1)
+			}
+		}
+		referenceRoot = int32(len(roots))
+		roots = append(roots, *referencePath)
+	}
+	if tempDir != "" && moveTo != "" {
+		// the copies across file systems are renamed into -move-to
+		preflight("-tmpdir "+tempDir+" usable for -move-to", "Invalid -tmpdir: %s", checkTempDir(existingParent(moveTo)))
+	} else if tempDir != "" {
+		for _, dir := range roots {
+			preflight("-tmpdir "+tempDir+" usable for "+dir, "Invalid -tmpdir: %s", checkTempDir(dir))
+		}
+	}
+	if doctorMode && len(roots) == 0 {
+		printDoctor()
+		os.Exit(1)
+	}
+	if includeXattr && !xattrSupported {
+		fmt.Fprintf(os.Stderr, "-include-xattr is only supported on Linux and macOS\n")
+		os.Exit(-1)
+	}
+	if includeXattr && *cachePath != "" {
+		fmt.Fprintf(os.Stderr, "-include-xattr can not be used with -cache, as changing attributes keeps the modification time\n")
+		os.Exit(-1)
+	}
+	if *cachePath != "" {
+		var err error
+		if cache, err = loadCache(*cachePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read the cache: %s\n", err)
+			os.Exit(-1)
+		}
+	}
+	if findFile != "" {
+		info, err := os.Stat(findFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read the file to find: %s\n", err)
+			os.Exit(-1)
+		}
+		if findHash, err = hashFile(findFile, newHash(), nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to hash the file to find: %s\n", err)
+			os.Exit(-1)
+		}
+		findInfo = info
+	}
+	if *jdupesExclude != "" {
+		if err := loadJdupesExclude(*jdupesExclude); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read the jdupes filters: %s\n", err)
+			os.Exit(-1)
+		}
+	}
+	if *summaryPath != "" && (uniquesMode || findFile != "" || dirsMode || *recordsMode != "" || *blockDedup || *goldenPath != "" || *manifestURL != "") {
+		fmt.Fprintf(os.Stderr, "-summary-json only summarizes a search for duplicate files\n")
+		os.Exit(-1)
+	}
+	if *goldenPath != "" && *manifestURL != "" {
+		fmt.Fprintf(os.Stderr, "-golden and -manifest-url can not be used together\n")
+		os.Exit(-1)
+	}
+	if *goldenPath != "" || *manifestURL != "" {
+		if goldenReport != "unknown" && goldenReport != "approved" {
+			fmt.Fprintf(os.Stderr, "Unknown -golden-report '%s'\n", goldenReport)
+			os.Exit(-1)
+		}
+		if actionMode() || *deleteHashes != "" || outputFormat != "text" || uniquesMode || findFile != "" || dirsMode || *recordsMode != "" || !keyed("content") {
+			fmt.Fprintf(os.Stderr, "-golden and -manifest-url only report files as text\n")
+			os.Exit(-1)
+		}
+		var hashes map[string]bool
+		var err error
+		if *manifestURL != "" {
+			hashes, err = fetchManifest(*manifestURL, *manifestCachePath)
+		} else {
+			hashes, err = loadHashList(*goldenPath)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read the golden hashes: %s\n", err)
+			os.Exit(-1)
+		}
+		goldenHashes = hashes
+	}
+	if *deleteHashes != "" {
+		hashes, err := loadHashList(*deleteHashes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read the hashes to delete: %s\n", err)
+			os.Exit(-1)
+		}
+		purgeHashes = hashes
+	}
+	if *outputPath != "" {
+		if err := openOutput(*outputPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to create the output file: %s\n", err)
+			os.Exit(-1)
+		}
+		statsOutput = os.Stderr
+	}
+	hideProgress = noStats || progressFormat == "json"
+	walkProgress = creatProgress("Walking through %d files ...", &hideProgress)
+	var server *http.Server
+	if *serveAddr != "" {
+		server = startServer(*serveAddr)
+	}
+	if findInfo != nil && !noStats {
+		fmt.Fprintf(statsOutput, "\nSearching copies of '%s' in '%s'\n\n", findFile, root)
+	} else if !noStats {
+		fmt.Fprintf(statsOutput, "\nSearching duplicates in '%s' with name that match '%s' and minimum size '%d' bytes\n\n", root, filenameMatch, minSize)
+	}
+	scanStart = time.Now()
+	// started before the walk, which -stream hashes along
+	stopNiceMonitor := startNiceMonitor()
+	stopStreamEvents := func() {}
+	if streamFiles {
+		// the walk progress shows the hashing, which has no total
+		hidden := true
+		hashProgress = creatProgress("", &hidden)
+		walkProgress.details = streamDetails
+		stopStreamEvents = startProgressEvents(hashProgress, "hash", 0)
+		stream = startHashStream(hashProgress, newHash)
+	}
+	stopWalkEvents := startProgressEvents(walkProgress, "walk", 0)
+	for i, dir := range roots {
+		currentRoot = int32(i)
+		err = walkRoot(dir)
+		if err == errMaxFiles || err == errInterrupted {
+			break
+		}
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+	if stream != nil {
+		checkHashing(stream.close())
+		stopStreamEvents()
+	}
+	stopWalkEvents()
 	walkProgress.delete()
-	computeHashes()
-	for _, v := range duplicates.m {
-		if len(v) > 1 {
-			dupCount++
-		}
-	}
-	if !noStats {
-		fmt.Printf("\nFound %d duplicates from %d files in %s with options { size: '%d', name: '%s' }\n", dupCount, fileCount, root, minSize, filenameMatch)
-	}
-	fmt.Printf("/n /n /n")
-	for _, v := range duplicates.m {
-		if len(v) > 1 {
-			for i, file := range v {
-				if i > 0 && delete {
-					deleteFile(file)
-				} else {
-					fmt.Printf("%s\n", file)
+	if interrupted() && stream == nil {
+		if !noStats {
+			fmt.Fprintf(statsOutput, "\nInterrupted during the walk after %d files, before any was hashed\n", len(walkFiles))
+		}
+		os.Exit(exitInterrupted)
+	}
+	if splitter != nil {
+		if !hideProgress {
+			fmt.Fprintln(statsOutput)
+		}
+		recordGroups, records := findDuplicateRecords(splitter, walkFiles, newHash)
+		writeRecordGroups(recordGroups)
+		if !noStats {
+			unit := "records"
+			if *blockDedup {
+				unit = "blocks"
+			}
+			fmt.Fprintf(statsOutput, "\nFound %d duplicate %s from %d %s in %d files in %s\n", len(recordGroups), unit, records, unit, fileCount, root)
+			printFailures()
+		}
+		closeOutput()
+		os.Exit(exitCode())
+	}
+	setScanPhase(phaseHashing)
+	// the reads measured by -rate, from the walk on with -stream which
+	// hashes along
+	readStart := time.Now()
+	if stream != nil {
+		readStart = scanStart
+	}
+	stopLiveSummary := startLiveSummary(*liveSummary)
+	if cache != nil && stream == nil {
+		cache.keep(walkFiles...)
+	}
+	var images []imageHash
+	if perceptual {
+		images = hashImages(walkFiles)
+	}
+	if stream == nil && findInfo == nil && len(purgeHashes) == 0 && !approximateHashing() && !dirsMode && goldenHashes == nil && keyed("content") {
+		walkFiles, prefiltered = prefilterCandidates(walkFiles)
+		if prehashBytes > 0 {
+			var unique []*WalkedFile
+			walkFiles, unique = prehashCandidates(walkFiles, newHash)
+			prefiltered = append(prefiltered, unique...)
+		}
+	}
+	if *sinkPath != "" {
+		if sink, err = openSink(*sinkPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to open the sink: %s\n", err)
+			os.Exit(-1)
+		}
+		sink.expect(walkFiles)
+	}
+	var lowMemoryScan *sizeScan
+	if lowMemory {
+		lowMemoryScan = hashBySize(newHash)
+		dupCount = lowMemoryScan.groups
+	} else if stream != nil {
+		// hashed during the walk
+	} else if keyed("content") {
+		checkHashing(computeHashes(newHash))
+	} else {
+		fileCount, scannedBytes = int64(len(walkFiles)), candidateBytes(walkFiles)
+	}
+	if sink != nil {
+		sink.close()
+	}
+	if cache != nil {
+		if err := cache.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to write the cache: %s\n", err)
+		} else if !noStats {
+			fmt.Fprintf(statsOutput, "\nReused %d cached hashes\n", cache.reused)
+		}
+	}
+	stopNiceMonitor()
+	stopLiveSummary()
+	if readLimiter != nil && !noStats {
+		read, reading := atomic.LoadInt64(&bytesRead), time.Since(readStart)
+		fmt.Fprintf(statsOutput, "\nRead %s in %s (%s/s on average)\n", formatSize(read), reading.Round(time.Millisecond), formatSize(int64(float64(read)/reading.Seconds())))
+	}
+	setScanPhase(phaseDone)
+	if server != nil {
+		stopServer(server)
+	}
+	if lowMemory {
+		printLowMemorySummary(root, lowMemoryScan)
+		if *summaryPath != "" {
+			var reclaimable int64
+			for _, freed := range lowMemoryScan.reclaimable {
+				reclaimable += freed
+			}
+			if err := writeSummary(*summaryPath, lowMemoryScan.groups, lowMemoryScan.copies, reclaimable); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to write the summary: %s\n", err)
+			}
+		}
+		closeOutput()
+		os.Exit(exitCode())
+	}
+	if interrupted() && (goldenHashes != nil || dirsMode) {
+		if !noStats {
+			fmt.Fprintf(statsOutput, "\nInterrupted while hashing, only duplicate files are listed from partial results\n")
+		}
+		os.Exit(exitInterrupted)
+	}
+	if goldenHashes != nil {
+		if !hideProgress {
+			fmt.Fprintln(statsOutput)
+		}
+		writeGoldenFiles(root, goldenFiles())
+		if !noStats {
+			printFailures()
+		}
+		closeOutput()
+		os.Exit(exitCode())
+	}
+	if dirsMode {
+		dirGroups := collectDirGroups()
+		if !hideProgress {
+			fmt.Fprintln(statsOutput)
+		}
+		writeDirGroups(dirGroups)
+		printDirSummary(root, dirGroups)
+		if !noStats {
+			printFailures()
+		}
+		closeOutput()
+		os.Exit(exitCode())
+	}
+	var purgeTargets []journalEntry
+	if len(purgeHashes) > 0 {
+		purgeTargets = takePurgeTargets()
+	}
+	var groups []*DuplicateGroup
+	if findInfo != nil {
+		groups = findGroup()
+		if verifyContent && len(groups) > 0 {
+			// only the copies holding the bytes of the file to find
+			wanted := groups[0].files[0]
+			if groups = verifyGroups(groups); len(groups) == 0 || groups[0].files[0] != wanted {
+				groups = nil
+			} else {
+				groups = groups[:1]
+			}
+		}
+	} else if uniquesMode {
+		groups = collectUniques()
+	} else if keyed("content") {
+		groups = collapseHardLinks(collectGroups())
+		if verifyContent {
+			verified := len(groups)
+			groups = verifyGroups(groups)
+			if !noStats {
+				printVerification(verified)
+			}
+		}
+		groups = splitByKey(groups)
+	} else {
+		groups = collapseHardLinks(groupByKey("", walkFiles))
+	}
+	sortGroups(groups)
+	if interrupted() {
+		expected := candidateSizes(walkFiles)
+		if stream != nil {
+			expected = stream.sizes
+		}
+		groups = completeGroups(groups, expected)
+		stopActions()
+		purgeTargets = nil
+	}
+	if flagTruncated && !uniquesMode {
+		separateTruncated(groups)
+	}
+	if mixedExtensions {
+		groups = filterMixedExtensions(groups)
+	}
+	if boundary != nil {
+		groups = filterBoundary(groups, boundary[0], boundary[1])
+	}
+	if referenceRoot >= 0 {
+		if !hideProgress {
+			fmt.Fprintln(statsOutput)
+		}
+		writeReferenceMatches(root, referenceMatches(groups))
+		if !noStats {
+			printFailures()
+		}
+		closeOutput()
+		os.Exit(exitCode())
+	}
+	if !uniquesMode {
+		groups = filterMinCopies(groups)
+	}
+	if *recentGroups > 0 {
+		groups = limitByModTime(groups, *recentGroups, false)
+	} else if *oldestGroups > 0 {
+		groups = limitByModTime(groups, *oldestGroups, true)
+	}
+	dupCount = int64(len(groups))
+	if !uniquesMode && findInfo == nil {
+		for _, g := range groups {
+			applyKeepStrategy(g)
+			applyKeepMode(g)
+		}
+	}
+	if moveTo != "" && !uniquesMode {
+		preflight("-move-to free space", "Unable to move the duplicates: %s", checkMoveSpace(groups))
+	}
+	if doctorMode {
+		failed := printDoctor()
+		closeOutput()
+		if failed > 0 {
+			os.Exit(1)
+		}
+		os.Exit(exitCode())
+	}
+	if *journalPath != "" && !dryRun {
+		planned := purgeTargets
+		if deleteMode && !uniquesMode {
+			planned = append(planned, plannedDeletions(groups)...)
+		}
+		if len(planned) > 0 {
+			if journal, err = openJournal(*journalPath, planned); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to write the deletion journal: %s\n", err)
+				os.Exit(-1)
+			}
+		}
+	}
+	if *restorePath != "" && !dryRun {
+		if restore, err = openRestoreScript(*restorePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to write the restore script: %s\n", err)
+			closeJournal()
+			os.Exit(-1)
+		}
+	}
+	if len(purgeHashes) > 0 {
+		for _, target := range purgeTargets {
+			deleteFile(target.path, target.kept)
+		}
+		if !noStats {
+			verb := "Deleted"
+			if dryRun {
+				verb = "Would delete"
+			}
+			fmt.Fprintf(statsOutput, "\n%s %d files matching the hashes of '%s'\n", verb, deletedFiles, *deleteHashes)
+		}
+	}
+	resolvePathPrefix(groups)
+	if *summaryPath != "" {
+		reclaimable, redundant := totalReclaimable(groups)
+		if err := writeSummary(*summaryPath, dupCount, redundant, reclaimable); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to write the summary: %s\n", err)
+		}
+	}
+	if *diffPath != "" {
+		if !hideProgress {
+			fmt.Fprintln(statsOutput)
+		}
+		changes := printDiff(baseline, groups)
+		if !noStats {
+			printFailures()
+		}
+		closeJournal()
+		closeRestoreScript()
+		closeOutput()
+		if changes > 0 {
+			os.Exit(1)
+		}
+		os.Exit(exitCode())
+	}
+	if outputFormat != "text" {
+		if outputFormat == "dot" {
+			writeDot(resultOutput, groups)
+		} else if outputFormat == "csv" {
+			writeCSV(resultOutput, groups)
+		} else {
+			writeJSON(resultOutput, groups)
+		}
+		if actionMode() {
+			for _, g := range groups {
+				for _, file := range g.files[1:] {
+					actOnDuplicate(g, file)
 				}
 			}
-			fmt.Println("---------")
 		}
+	} else {
+		if !hideProgress {
+			fmt.Fprintln(statsOutput)
+		}
+		writeText(groups)
 	}
-
-	if !noStats {
-		fmt.Printf("\nFound %d duplicates from %d files in %s with options { size: '%d', name: '%s' }\n", dupCount, fileCount, root, minSize, filenameMatch)
+	var clusters [][]*WalkedFile
+	if perceptual {
+		clusters = nearDuplicates(images, groups)
+		writeNearDuplicates(clusters)
+	}
+	printSummary(root, groups)
+	if perceptual && !noStats {
+		printNearDuplicates(clusters)
+	}
+	if interrupted() && !noStats {
+		printInterrupted(len(groups))
 	}
-	os.Exit(0)
+	closeJournal()
+	closeRestoreScript()
+	closeOutput()
+	os.Exit(exitCode())
 }
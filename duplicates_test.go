@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeInfo an os.FileInfo for the filters, which never touch the disk
+type fakeInfo struct {
+	name string
+	size int64
+	mode os.FileMode
+}
+
+func (f fakeInfo) Name() string       { return f.name }
+func (f fakeInfo) Size() int64        { return f.size }
+func (f fakeInfo) Mode() os.FileMode  { return f.mode }
+func (f fakeInfo) ModTime() time.Time { return time.Time{} }
+func (f fakeInfo) IsDir() bool        { return f.mode.IsDir() }
+func (f fakeInfo) Sys() interface{}   { return nil }
+
+func TestEligible(t *testing.T) {
+	defer func(min, max int64, empty bool) { minSize, maxSize, ignoreEmpty = min, max, empty }(minSize, maxSize, ignoreEmpty)
+	for _, tc := range []struct {
+		name        string
+		min, max    int64
+		size        int64
+		ignoreEmpty bool
+		mode        os.FileMode
+		want        bool
+	}{
+		{"below -size", 10, 0, 9, true, 0, false},
+		{"at -size", 10, 0, 10, true, 0, true},
+		{"above -size", 10, 0, 11, true, 0, true},
+		{"below default -size", 1, 0, 0, true, 0, false},
+		{"at default -size", 1, 0, 1, true, 0, true},
+		{"below -max-size", 1, 100, 99, true, 0, true},
+		{"at -max-size", 1, 100, 100, true, 0, true},
+		{"above -max-size", 1, 100, 101, true, 0, false},
+		{"-size equals -max-size", 100, 100, 100, true, 0, true},
+		{"no -max-size limit", 1, 0, 1 << 40, true, 0, true},
+		{"empty file skipped", 0, 0, 0, true, 0, false},
+		{"empty file with -ignore-empty=false", 0, 0, 0, false, 0, true},
+		{"directory", 0, 0, 4096, true, os.ModeDir, false},
+		{"named pipe", 0, 0, 0, false, os.ModeNamedPipe, false},
+		{"socket", 0, 0, 0, false, os.ModeSocket, false},
+		{"character device", 0, 0, 0, false, os.ModeDevice | os.ModeCharDevice, false},
+		{"block device", 0, 0, 0, false, os.ModeDevice, false},
+		{"symbolic link", 0, 0, 12, true, os.ModeSymlink, false},
+	} {
+		minSize, maxSize, ignoreEmpty = tc.min, tc.max, tc.ignoreEmpty
+		f := fakeInfo{name: "file.dat", size: tc.size, mode: tc.mode}
+		if got := eligible(f); got != tc.want {
+			t.Errorf("%s: eligible(size %d) with -size %d -max-size %d = %v, want %v", tc.name, tc.size, tc.min, tc.max, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"duplicates/dedup"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ignoreFileName the file listing, like a .gitignore, the globs skipped in
+// the directory holding it and below
+const ignoreFileName = ".duplicatesignore"
+
+var (
+	// excludePatterns the -exclude globs, matched against the path and the
+	// name of every walked file and directory
+	excludePatterns stringList
+	// noIgnoreFiles skips reading the .duplicatesignore files
+	noIgnoreFiles bool
+	// ignorePatterns the globs of the .duplicatesignore files read by the
+	// walk, by the cleaned path of their directory
+	ignorePatterns = make(map[string][]string)
+)
+
+// excluded reports whether a walked path matches one of the -exclude globs,
+// either as a whole or by its last element, so that "node_modules" prunes
+// every directory of that name and "/data/*/cache" a single level.
+func excluded(path string) bool {
+	return dedup.Excluded(excludePatterns, path)
+}
+
+// loadIgnoreFile reads the .duplicatesignore file of a walked directory, if
+// any. Blank lines and lines starting with # are skipped.
+func loadIgnoreFile(dir string) {
+	file, err := os.Open(filepath.Join(dir, ignoreFileName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithError(err).WithField("dir", dir).Warn("Unable to read the ignore file")
+		}
+		return
+	}
+	defer file.Close()
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := filepath.Match(line, ""); err != nil {
+			log.WithField("pattern", line).Warnf("Ignoring an invalid pattern of %s", filepath.Join(dir, ignoreFileName))
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if len(patterns) > 0 {
+		ignorePatterns[filepath.Clean(dir)] = patterns
+	}
+}
+
+// ignoredByFile reports whether a walked path matches a pattern of the
+// .duplicatesignore files of the directories above it. As in a .gitignore,
+// a pattern with a slash is matched against the path relative to the
+// directory of its file, others against the name alone, and a pattern
+// ending with a slash only matches directories. Negations are not
+// supported.
+func ignoredByFile(path string, isDir bool) bool {
+	if len(ignorePatterns) == 0 {
+		return false
+	}
+	name := filepath.Base(path)
+	for dir := filepath.Dir(path); ; {
+		for _, pattern := range ignorePatterns[dir] {
+			if strings.HasSuffix(pattern, "/") {
+				if !isDir {
+					continue
+				}
+				pattern = strings.TrimSuffix(pattern, "/")
+			}
+			target := name
+			if strings.Contains(pattern, "/") {
+				pattern = strings.TrimPrefix(pattern, "/")
+				target, _ = filepath.Rel(dir, path)
+				target = filepath.ToSlash(target)
+			}
+			if ok, _ := filepath.Match(pattern, target); ok {
+				return true
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var ignoreExif bool
+
+var errNotImage = errors.New("not a JPEG or TIFF image")
+
+// copyImageData writes to w the image data of a JPEG or TIFF file, leaving
+// out the metadata, so that copies differing only by their EXIF hash alike.
+func copyImageData(r *bufio.Reader, at io.ReaderAt, w io.Writer) error {
+	magic, err := r.Peek(4)
+	if err != nil {
+		return errNotImage
+	}
+	switch {
+	case magic[0] == 0xFF && magic[1] == 0xD8:
+		return copyJPEGImageData(r, w)
+	case bytes.Equal(magic, []byte("II*\x00")) || bytes.Equal(magic, []byte("MM\x00*")):
+		return copyTIFFImageData(at, w)
+	}
+	return errNotImage
+}
+
+// copyJPEGImageData copies every JPEG segment but the APPn ones, where EXIF,
+// XMP and ICC metadata live, and the comments.
+func copyJPEGImageData(r *bufio.Reader, w io.Writer) error {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(soi[:]); err != nil {
+		return err
+	}
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != 0xFF {
+			return errors.New("malformed JPEG marker")
+		}
+		marker := byte(0xFF)
+		for marker == 0xFF {
+			if marker, err = r.ReadByte(); err != nil {
+				return err
+			}
+		}
+		if marker == 0xD9 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			// markers without a length
+			if _, err := w.Write([]byte{0xFF, marker}); err != nil {
+				return err
+			}
+			if marker == 0xD9 {
+				return nil
+			}
+			continue
+		}
+		var size [2]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return err
+		}
+		length := int64(binary.BigEndian.Uint16(size[:]))
+		if length < 2 {
+			return errors.New("malformed JPEG segment")
+		}
+		if (marker >= 0xE0 && marker <= 0xEF) || marker == 0xFE {
+			if _, err := r.Discard(int(length - 2)); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := w.Write([]byte{0xFF, marker, size[0], size[1]}); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, r, length-2); err != nil {
+			return err
+		}
+		if marker == 0xDA {
+			// start of scan: the rest of the file is image data
+			_, err := io.Copy(w, r)
+			return err
+		}
+	}
+}
+
+// TIFF tags describing the image, hashed along with its pixel data
+var tiffImageTags = map[uint16]bool{
+	256: true, // ImageWidth
+	257: true, // ImageLength
+	258: true, // BitsPerSample
+	259: true, // Compression
+	262: true, // PhotometricInterpretation
+	277: true, // SamplesPerPixel
+	317: true, // Predictor
+	322: true, // TileWidth
+	323: true, // TileLength
+}
+
+// copyTIFFImageData copies the tags describing the first image of a TIFF
+// file followed by its strips or tiles, ignoring every other tag.
+func copyTIFFImageData(at io.ReaderAt, w io.Writer) error {
+	var header [8]byte
+	if _, err := at.ReadAt(header[:], 0); err != nil {
+		return err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if header[0] == 'M' {
+		order = binary.BigEndian
+	}
+	ifd := int64(order.Uint32(header[4:]))
+	var count [2]byte
+	if _, err := at.ReadAt(count[:], ifd); err != nil {
+		return err
+	}
+	entries := make([]byte, 12*int(order.Uint16(count[:])))
+	if _, err := at.ReadAt(entries, ifd+2); err != nil {
+		return err
+	}
+
+	var offsets, counts []int64
+	for i := 0; i < len(entries); i += 12 {
+		entry := entries[i : i+12]
+		tag := order.Uint16(entry)
+		switch tag {
+		case 273, 324: // StripOffsets, TileOffsets
+			values, err := readTIFFValues(at, order, entry)
+			if err != nil {
+				return err
+			}
+			offsets = append(offsets, values...)
+		case 279, 325: // StripByteCounts, TileByteCounts
+			values, err := readTIFFValues(at, order, entry)
+			if err != nil {
+				return err
+			}
+			counts = append(counts, values...)
+		default:
+			if tiffImageTags[tag] {
+				if _, err := w.Write(entry); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if len(offsets) == 0 || len(offsets) != len(counts) {
+		return errors.New("malformed TIFF image data")
+	}
+	for i := range offsets {
+		if _, err := io.Copy(w, io.NewSectionReader(at, offsets[i], counts[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTIFFValues reads the SHORT or LONG values of a TIFF entry, stored in
+// the entry itself when they fit in four bytes.
+func readTIFFValues(at io.ReaderAt, order binary.ByteOrder, entry []byte) ([]int64, error) {
+	size := int64(4)
+	if order.Uint16(entry[2:]) == 3 {
+		size = 2
+	}
+	n := int64(order.Uint32(entry[4:]))
+	if n > 1<<20 {
+		return nil, errors.New("malformed TIFF entry")
+	}
+	data := entry[8:12]
+	if n*size > 4 {
+		data = make([]byte, n*size)
+		if _, err := at.ReadAt(data, int64(order.Uint32(entry[8:]))); err != nil {
+			return nil, err
+		}
+	}
+	values := make([]int64, n)
+	for i := range values {
+		if size == 2 {
+			values[i] = int64(order.Uint16(data[int64(i)*2:]))
+		} else {
+			values[i] = int64(order.Uint32(data[int64(i)*4:]))
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// exitIncomplete the exit code of a scan that went through the end but
+// skipped files or directories it could not read. Invalid options and
+// other fatal errors exit with -1.
+const exitIncomplete = 2
+
+// failedFiles counts the files and directories that could not be walked,
+// opened, hashed or verified, which the results are missing
+var failedFiles int64
+
+// countFailure records a path the results are missing, logging why
+func countFailure(path string, err error, msg string) {
+	atomic.AddInt64(&failedFiles, 1)
+	log.WithFields(log.Fields{
+		"path":  path,
+		"error": err,
+	}).Error(msg)
+}
+
+func printFailures() {
+	if failed := atomic.LoadInt64(&failedFiles); failed > 0 {
+		fmt.Fprintf(statsOutput, "Skipped %d files or directories that could not be read, the results are incomplete\n", failed)
+	}
+}
+
+// checkHashing exits when the hashing was aborted by an error other than an
+// interruption, the results being truncated beyond what printFailures can
+// tell. Files that can not be read are counted by countFailure and never
+// abort the hashing.
+func checkHashing(err error) {
+	if err == nil || interrupted() {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Hashing aborted: %s\n", err)
+	os.Exit(-1)
+}
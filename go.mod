@@ -2,9 +2,13 @@ module duplicates
 
 go 1.19
 
-require github.com/sirupsen/logrus v1.9.0
-
 require (
-	github.com/stretchr/testify v1.8.0 // indirect
-	golang.org/x/sys v0.0.0-20221010170243-090e33056c14 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0
+	github.com/sirupsen/logrus v1.9.0
+	golang.org/x/sys v0.0.0-20221010170243-090e33056c14
+	golang.org/x/term v0.1.0
+	golang.org/x/text v0.3.8
+	golang.org/x/time v0.5.0
 )
+
+require github.com/stretchr/testify v1.8.0 // indirect
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+var (
+	// goldenHashes the approved content hashes of -golden
+	goldenHashes map[string]bool
+	// goldenReport the files reported against them: those whose content is
+	// not approved ("unknown") or those holding approved content ("approved")
+	goldenReport = "unknown"
+)
+
+// goldenFiles returns the paths of the hashed files matching -golden-report,
+// sorted.
+func goldenFiles() []string {
+	duplicates.RLock()
+	defer duplicates.RUnlock()
+	var paths []string
+	for hash, files := range duplicates.m {
+		if goldenHashes[hash] != (goldenReport == "approved") {
+			continue
+		}
+		for _, file := range files {
+			paths = append(paths, file.path())
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func writeGoldenFiles(root string, paths []string) {
+	for _, path := range paths {
+		fmt.Fprintf(resultOutput, "%s\n", displayPath(path))
+	}
+	if !noStats {
+		kind := "not matching"
+		if goldenReport == "approved" {
+			kind = "matching"
+		}
+		fmt.Fprintf(statsOutput, "\nFound %d files %s the %d golden hashes from %d files in %s\n", len(paths), kind, len(goldenHashes), fileCount, root)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// loadHashList reads a list of content hashes, one per line. Blank lines and
+// lines starting with '#' are ignored and only the first field of a line is
+// kept, so the output of md5sum can be used as is.
+func loadHashList(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseHashList(file)
+}
+
+// parseHashList reads a list of content hashes in the format of loadHashList
+func parseHashList(r io.Reader) (map[string]bool, error) {
+	hashes := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hashes[strings.ToLower(strings.Fields(line)[0])] = true
+	}
+	return hashes, scanner.Err()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"duplicates/dedup"
+)
+
+// finder the library options the deletions go through: its ShouldDelete
+// hook, set by -protect, is asked before every deletion, link or move
+var finder = &dedup.Finder{}
+
+func toFileEntry(file *WalkedFile) dedup.FileEntry {
+	return dedup.FileEntry{
+		Path:    file.path(),
+		Size:    file.file.Size(),
+		ModTime: file.file.ModTime(),
+		Mode:    file.file.Mode(),
+	}
+}
+
+// vetoed reports whether the ShouldDelete hook refuses to remove file
+func vetoed(files []*WalkedFile, file *WalkedFile) bool {
+	if finder.ShouldDelete == nil {
+		return false
+	}
+	group := make([]dedup.FileEntry, len(files))
+	for i, member := range files {
+		group[i] = toFileEntry(member)
+	}
+	return !finder.Deletable(group, toFileEntry(file))
+}
+
+// protectPaths installs a ShouldDelete hook that never removes the files
+// found under one of the given directories.
+func protectPaths(dirs []string) {
+	for i, dir := range dirs {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dirs[i] = abs
+		}
+	}
+	finder.ShouldDelete = func(group []dedup.FileEntry, candidate dedup.FileEntry) bool {
+		path, err := filepath.Abs(candidate.Path)
+		if err != nil {
+			return false
+		}
+		for _, dir := range dirs {
+			if path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator)) {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+var (
+	// interactive asks, for each group, which copies -delete keeps
+	interactive bool
+	// interactiveQuit stops the questions and the deletions for the
+	// groups left
+	interactiveQuit bool
+	answers         *bufio.Scanner
+)
+
+// checkInteractive makes sure the questions of -interactive can be answered:
+// with stdin not a terminal, a script or a pipe would be read as answers,
+// or the scan would wait on them forever. Character devices that are not
+// terminals, such as /dev/null, are refused as well.
+func checkInteractive() error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("stdin is not a terminal")
+	}
+	answers = bufio.NewScanner(os.Stdin)
+	return nil
+}
+
+// promptGroup lists the members of a group by index and deletes the ones
+// the answer does not keep. The answer is a list of the indexes to keep,
+// "s" to keep them all and skip the group, "k N" to keep the first N, the
+// others being deleted, or "q" to quit, the groups left being listed but
+// not acted upon. The copy kept by -keep comes first.
+func promptGroup(g *DuplicateGroup) {
+	for i, file := range g.files {
+		fmt.Fprintf(resultOutput, "[%d] %s\n", i+1, displayPath(file.path()))
+	}
+	for {
+		fmt.Fprintf(resultOutput, "Keep which copies? (indexes, s to skip, k N to keep the first N, q to quit) [1]: ")
+		if !answers.Scan() {
+			fmt.Fprintln(resultOutput)
+			interactiveQuit = true
+			break
+		}
+		keep, err := parseAnswer(strings.TrimSpace(answers.Text()), len(g.files))
+		if err != nil {
+			fmt.Fprintf(resultOutput, "%s\n", err)
+			continue
+		}
+		if keep != nil {
+			deleteUnkept(g, keep)
+		}
+		break
+	}
+	fmt.Fprintln(resultOutput, "---------")
+}
+
+// parseAnswer returns the indexes kept by an answer, nil when nothing is
+// deleted. An empty answer keeps the first copy.
+func parseAnswer(answer string, members int) (map[int]bool, error) {
+	keep := make(map[int]bool)
+	fields := strings.Fields(answer)
+	switch {
+	case len(fields) == 0:
+		keep[0] = true
+	case fields[0] == "s":
+		return nil, nil
+	case fields[0] == "q":
+		interactiveQuit = true
+		return nil, nil
+	case fields[0] == "k":
+		if len(fields) != 2 {
+			return nil, errors.New("k takes the number of copies to keep")
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 1 || n > members {
+			return nil, fmt.Errorf("keep between 1 and %d copies", members)
+		}
+		for i := 0; i < n; i++ {
+			keep[i] = true
+		}
+	default:
+		for _, field := range fields {
+			i, err := strconv.Atoi(field)
+			if err != nil || i < 1 || i > members {
+				return nil, fmt.Errorf("'%s' is not an index between 1 and %d", field, members)
+			}
+			keep[i-1] = true
+		}
+	}
+	if len(keep) == members {
+		return nil, nil
+	}
+	return keep, nil
+}
+
+// deleteUnkept deletes the members of a group out of keep, through
+// actOnDuplicate so that -protect, -dry-run and the restore script apply,
+// the first kept copy being the one they are duplicates of.
+func deleteUnkept(g *DuplicateGroup, keep map[int]bool) {
+	var kept, unkept []*WalkedFile
+	for i, file := range g.files {
+		if keep[i] {
+			kept = append(kept, file)
+		} else {
+			unkept = append(unkept, file)
+		}
+	}
+	g.files = append(kept, unkept...)
+	for _, file := range unkept {
+		actOnDuplicate(g, file)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// exitInterrupted the exit code of a scan stopped by a signal, as shells
+// report a process killed by SIGINT
+const exitInterrupted = 130
+
+var (
+	// scanContext is canceled by the first SIGINT or SIGTERM: the walk stops
+	// and the hashing workers finish the file they are reading
+	scanContext, cancelScan = context.WithCancel(context.Background())
+	errInterrupted          = errors.New("interrupted")
+	// hashedSizes counts the candidates of each size the workers went
+	// through, hashed or not, to tell the groups whose size was completed
+	hashedSizes = struct {
+		sync.Mutex
+		m map[int64]int
+	}{m: make(map[int64]int)}
+)
+
+// handleInterrupts cancels the scan on the first SIGINT or SIGTERM and
+// exits at once on the second one.
+func handleInterrupts() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Warn("Interrupted, finishing the files being hashed (interrupt again to quit)")
+		cancelScan()
+		<-signals
+		os.Exit(exitInterrupted)
+	}()
+}
+
+func interrupted() bool {
+	return scanContext.Err() != nil
+}
+
+// exitCode returns the exit code of a scan that went through the end,
+// skipped unreadable files, or was interrupted
+func exitCode() int {
+	if interrupted() {
+		return exitInterrupted
+	}
+	if atomic.LoadInt64(&failedFiles) > 0 {
+		return exitIncomplete
+	}
+	return 0
+}
+
+func markHashed(file *WalkedFile) {
+	hashedSizes.Lock()
+	hashedSizes.m[memberSize(file)]++
+	hashedSizes.Unlock()
+}
+
+// candidateSizes counts the candidates of each size
+func candidateSizes(candidates []*WalkedFile) map[int64]int {
+	sizes := make(map[int64]int)
+	for _, file := range candidates {
+		sizes[memberSize(file)]++
+	}
+	return sizes
+}
+
+// completeGroups keeps, after an interruption, the groups whose files are
+// all known: those of a size whose candidates were all hashed. Approximate
+// hashing groups files of different sizes, so its groups are only complete
+// once every candidate was hashed.
+func completeGroups(groups []*DuplicateGroup, expected map[int64]int) []*DuplicateGroup {
+	hashedSizes.Lock()
+	defer hashedSizes.Unlock()
+	allHashed := true
+	for size, count := range expected {
+		if hashedSizes.m[size] < count {
+			allHashed = false
+		}
+	}
+	var complete []*DuplicateGroup
+	for _, g := range groups {
+		size := memberSize(g.files[0])
+		if allHashed || (!approximateHashing() && hashedSizes.m[size] >= expected[size]) {
+			complete = append(complete, g)
+		}
+	}
+	return complete
+}
+
+// stopActions turns the scan into a listing once it was interrupted, so
+// that nothing is deleted, linked or moved from partial results.
+func stopActions() {
+	deleteMode, hardlinkMode, moveTo = false, false, ""
+	purgeHashes = nil
+}
+
+func printInterrupted(groups int) {
+	fmt.Fprintf(statsOutput, "\nInterrupted: only the %d groups whose files were all hashed are listed, and none was acted upon\n", groups)
+}
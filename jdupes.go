@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// jdupesRule a filter of -jdupes-exclude, telling whether a file is scanned
+type jdupesRule func(path string, f os.FileInfo) bool
+
+var jdupesRules []jdupesRule
+
+// loadJdupesExclude reads the -X (--ext-filter) specs of jdupes, one per
+// line, with or without the option in front of them. The size, nostr,
+// onlystr, noext and onlyext filters are supported; the others are
+// reported and ignored.
+func loadJdupesExclude(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		spec := strings.TrimSpace(scanner.Text())
+		if spec == "" || strings.HasPrefix(spec, "#") {
+			continue
+		}
+		spec = strings.TrimPrefix(spec, "--ext-filter=")
+		spec = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(spec, "--ext-filter"), "-X"))
+		rule, err := parseJdupesSpec(spec)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"file": path,
+				"line": line,
+				"spec": spec,
+			}).Warn("Ignoring jdupes filter: " + err.Error())
+			continue
+		}
+		jdupesRules = append(jdupesRules, rule)
+	}
+	return scanner.Err()
+}
+
+func parseJdupesSpec(spec string) (jdupesRule, error) {
+	name, value, found := strings.Cut(spec, ":")
+	if !found {
+		return nil, fmt.Errorf("missing ':'")
+	}
+	switch {
+	case strings.HasPrefix(name, "size"):
+		return parseJdupesSize(strings.TrimPrefix(name, "size"), value)
+	case name == "nostr":
+		return func(path string, f os.FileInfo) bool { return !strings.Contains(path, value) }, nil
+	case name == "onlystr":
+		return func(path string, f os.FileInfo) bool { return strings.Contains(path, value) }, nil
+	case name == "noext", name == "onlyext":
+		exts := make(map[string]bool)
+		for _, ext := range strings.Split(value, ",") {
+			exts[strings.ToLower(strings.TrimPrefix(ext, "."))] = true
+		}
+		only := name == "onlyext"
+		return func(path string, f os.FileInfo) bool {
+			return exts[strings.ToLower(strings.TrimPrefix(filepath.Ext(f.Name()), "."))] == only
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported filter '%s'", name)
+}
+
+// parseJdupesSize reads size[+-=]:N, keeping the files larger (+), smaller
+// (-) or equal (=) to N, the operators being combinable as in size+=:100k.
+func parseJdupesSize(ops, value string) (jdupesRule, error) {
+	if ops == "" || strings.Trim(ops, "+-=") != "" {
+		return nil, fmt.Errorf("invalid size operators '%s'", ops)
+	}
+	value = strings.ToUpper(value)
+	if strings.HasSuffix(value, "K") || strings.HasSuffix(value, "M") || strings.HasSuffix(value, "G") || strings.HasSuffix(value, "T") {
+		value += "B"
+	}
+	size, err := parseSize(value)
+	if err != nil {
+		return nil, err
+	}
+	larger, smaller, equal := strings.Contains(ops, "+"), strings.Contains(ops, "-"), strings.Contains(ops, "=")
+	return func(path string, f os.FileInfo) bool {
+		return (larger && f.Size() > size) || (smaller && f.Size() < size) || (equal && f.Size() == size)
+	}, nil
+}
+
+// jdupesAllows reports whether a file passes every -jdupes-exclude filter
+func jdupesAllows(path string, f os.FileInfo) bool {
+	for _, rule := range jdupesRules {
+		if !rule(path, f) {
+			return false
+		}
+	}
+	return true
+}
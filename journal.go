@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"hash"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// journalEntry a deletion planned in the journal, by absolute paths so that
+// it can be resumed from any directory. kept is the copy the deleted file
+// duplicates, empty for deletions forced by -delete-hashes.
+type journalEntry struct {
+	hash string
+	kept string
+	path string
+}
+
+// deletionJournal an append only log of planned and completed deletions,
+// synced after every write so it survives an interrupted run.
+type deletionJournal struct {
+	sync.Mutex
+	file *os.File
+}
+
+var journal *deletionJournal
+
+func plannedDeletions(groups []*DuplicateGroup) []journalEntry {
+	var planned []journalEntry
+	for _, g := range groups {
+		kept := absPath(g.files[0].path())
+		for _, file := range g.files[1:] {
+			if !vetoed(g.files, file) {
+				planned = append(planned, journalEntry{hash: g.hash, kept: kept, path: absPath(file.path())})
+			}
+		}
+	}
+	return planned
+}
+
+// openJournal truncates the journal and records the hashing in use, then
+// every planned deletion before any of them is performed.
+func openJournal(path string, planned []journalEntry) (*deletionJournal, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	j := &deletionJournal{file: file}
+	if err := j.write("hashing " + hashingMode() + "\n"); err != nil {
+		file.Close()
+		return nil, err
+	}
+	for _, entry := range planned {
+		if err := j.write(fmt.Sprintf("plan %s %s %s\n", entry.hash, strconv.Quote(entry.kept), strconv.Quote(entry.path))); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+func appendJournal(path string) (*deletionJournal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &deletionJournal{file: file}, nil
+}
+
+func (j *deletionJournal) write(line string) error {
+	j.Lock()
+	defer j.Unlock()
+	if _, err := j.file.WriteString(line); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *deletionJournal) markDone(path string) {
+	if err := j.write("done " + strconv.Quote(absPath(path)) + "\n"); err != nil {
+		log.WithFields(log.Fields{
+			"path":  path,
+			"error": err,
+		}).Error("Failed to update the deletion journal")
+	}
+}
+
+// closeJournal closes the -journal, if open, before the program exits,
+// which skips the deferred calls
+func closeJournal() {
+	if journal != nil {
+		journal.close()
+		journal = nil
+	}
+}
+
+func (j *deletionJournal) close() {
+	if err := j.file.Close(); err != nil {
+		log.WithError(err).Error("Failed to close the deletion journal")
+	}
+}
+
+// readJournal returns the planned deletions not marked as done yet, and the
+// hashing they were planned with, empty for a journal that does not tell
+func readJournal(path string) (pending []journalEntry, mode string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	var planned []journalEntry
+	done := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := scanner.Text()
+		switch {
+		case strings.HasPrefix(fields, "hashing "):
+			mode = strings.TrimPrefix(fields, "hashing ")
+		case strings.HasPrefix(fields, "plan "):
+			var entry journalEntry
+			rest := strings.TrimPrefix(fields, "plan ")
+			if i := strings.IndexByte(rest, ' '); i > 0 {
+				entry.hash, rest = rest[:i], rest[i+1:]
+			}
+			if entry.kept, rest, err = unquoteField(rest); err == nil {
+				entry.path, _, err = unquoteField(rest)
+			}
+			if err != nil || entry.hash == "" {
+				return nil, "", fmt.Errorf("malformed journal line %d", line)
+			}
+			planned = append(planned, entry)
+		case strings.HasPrefix(fields, "done "):
+			path, _, err := unquoteField(strings.TrimPrefix(fields, "done "))
+			if err != nil {
+				// a line cut by a crash, the deletion will be verified again
+				continue
+			}
+			done[path] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
+
+	for _, entry := range planned {
+		if !done[entry.path] {
+			pending = append(pending, entry)
+		}
+	}
+	return pending, mode, nil
+}
+
+func unquoteField(s string) (string, string, error) {
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", err
+	}
+	value, err := strconv.Unquote(quoted)
+	return value, strings.TrimPrefix(s[len(quoted):], " "), err
+}
+
+// matchesHash reports whether a file still exists with the given content
+func matchesHash(path, want string, newHash func() hash.Hash) bool {
+	current, err := hashFile(path, newHash(), nil)
+	return err == nil && current == want
+}
+
+// resumeJournal performs the deletions of a journal that were not completed,
+// after checking again, with the hashing recorded by the journal, that each
+// file and the copy it duplicates still hold the expected content. It
+// returns the number of deletions skipped for no longer matching.
+func resumeJournal(path string) (int, error) {
+	pending, mode, err := readJournal(path)
+	if err != nil {
+		return 0, err
+	}
+	if mode != "" {
+		if err := setHashingMode(mode); err != nil {
+			return 0, err
+		}
+	}
+	newHash, err := hasherFactory()
+	if err != nil {
+		return 0, err
+	}
+	if journal, err = appendJournal(path); err != nil {
+		return 0, err
+	}
+	defer journal.close()
+	skipped := 0
+	for _, entry := range pending {
+		if !matchesHash(entry.path, entry.hash, newHash) || (entry.kept != "" && !matchesHash(entry.kept, entry.hash, newHash)) {
+			log.WithFields(log.Fields{
+				"path": entry.path,
+				"kept": entry.kept,
+			}).Warn("Skipping deletion that no longer matches the journal")
+			skipped++
+			continue
+		}
+		deleteFile(entry.path, entry.kept)
+	}
+	if !noStats {
+		fmt.Fprintf(statsOutput, "\nResumed %d pending deletions from '%s', skipped %d that no longer match\n", len(pending)-skipped, path, skipped)
+		printDeletions()
+	}
+	return skipped, nil
+}
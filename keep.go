@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+)
+
+var (
+	// keepStrategy selects the copy kept in each group
+	keepStrategy = "first"
+	keepSeed     int64
+)
+
+func parseKeepStrategy() error {
+	switch keepStrategy {
+	case "first", "random", "oldest", "newest", "shortest-path":
+		return nil
+	}
+	return fmt.Errorf("unknown strategy '%s' (first, oldest, newest, shortest-path, random)", keepStrategy)
+}
+
+// applyKeepStrategy moves the copy to keep to the front of the group. oldest
+// and newest compare modification times and shortest-path the length of the
+// paths, ties keeping the path order. With random, the members are sorted by
+// path and the choice is drawn from the seed and the group hash, so the same
+// seed keeps the same files whatever order the groups and their members were
+// found in.
+func applyKeepStrategy(g *DuplicateGroup) {
+	switch keepStrategy {
+	case "oldest":
+		sort.SliceStable(g.files, func(i, j int) bool { return g.files[i].file.ModTime().Before(g.files[j].file.ModTime()) })
+	case "newest":
+		sort.SliceStable(g.files, func(i, j int) bool { return g.files[i].file.ModTime().After(g.files[j].file.ModTime()) })
+	case "shortest-path":
+		sort.SliceStable(g.files, func(i, j int) bool { return len(g.files[i].path()) < len(g.files[j].path()) })
+	case "random":
+		sort.Slice(g.files, func(i, j int) bool { return g.files[i].path() < g.files[j].path() })
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(g.hash))
+		r := rand.New(rand.NewSource(keepSeed ^ int64(h.Sum64())))
+		kept := r.Intn(len(g.files))
+		g.files[0], g.files[kept] = g.files[kept], g.files[0]
+	}
+}
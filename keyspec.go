@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// groupKey the components files must all agree on to be duplicates
+var groupKey = []string{"content"}
+
+// keyComponents the components of -key besides content, each returning
+// the value files are compared on
+var keyComponents = map[string]func(*WalkedFile) string{
+	"size": func(f *WalkedFile) string { return fmt.Sprint(f.file.Size()) },
+	"ext":  func(f *WalkedFile) string { return strings.ToLower(filepath.Ext(f.file.Name())) },
+	"name": func(f *WalkedFile) string { return f.file.Name() },
+	"dir":  func(f *WalkedFile) string { return walkedDirs.dir(f.dir) },
+}
+
+// parseKey reads a comma separated list of key components
+func parseKey(spec string) error {
+	var key []string
+	seen := make(map[string]bool)
+	for _, component := range strings.Split(spec, ",") {
+		component = strings.TrimSpace(component)
+		if component != "content" && keyComponents[component] == nil {
+			return fmt.Errorf("unknown component '%s' (content, size, ext, name, dir)", component)
+		}
+		if !seen[component] {
+			seen[component] = true
+			key = append(key, component)
+		}
+	}
+	groupKey = key
+	return nil
+}
+
+// keyed reports whether files are compared on the given component
+func keyed(component string) bool {
+	for _, c := range groupKey {
+		if c == component {
+			return true
+		}
+	}
+	return false
+}
+
+// fileKey describes the values of a file for the components of the key
+// other than content, such as "ext=.jpg size=1024"
+func fileKey(f *WalkedFile) string {
+	var parts []string
+	for _, component := range groupKey {
+		if component != "content" {
+			parts = append(parts, component+"="+keyComponents[component](f))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// splitByKey splits the groups of files sharing the same content so that
+// the files of each group also agree on the other components of the key,
+// dropping the files left alone.
+func splitByKey(groups []*DuplicateGroup) []*DuplicateGroup {
+	if len(groupKey) == 1 {
+		return groups
+	}
+	var split []*DuplicateGroup
+	for _, g := range groups {
+		for _, part := range groupByKey(g.hash, g.files) {
+			part.links = g.links
+			split = append(split, part)
+		}
+	}
+	return split
+}
+
+// groupByKey groups files by the components of the key other than content,
+// keeping the groups of at least two files. Groups not compared on content
+// are identified by their key rather than a hash.
+func groupByKey(hash string, files []*WalkedFile) []*DuplicateGroup {
+	byKey := make(map[string]*DuplicateGroup)
+	var keys []string
+	for _, file := range files {
+		key := fileKey(file)
+		if byKey[key] == nil {
+			id := hash
+			if id == "" {
+				id = key
+			}
+			byKey[key] = &DuplicateGroup{hash: id}
+			keys = append(keys, key)
+		}
+		byKey[key].files = append(byKey[key].files, file)
+	}
+	sort.Strings(keys)
+	var groups []*DuplicateGroup
+	for _, key := range keys {
+		if len(byKey[key].files) > 1 {
+			groups = append(groups, byKey[key])
+		}
+	}
+	return groups
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tempDir where intermediate files are created, next to their destination
+// when empty
+var tempDir string
+
+// checkTempDir verifies that the -tmpdir is writable and on the same file
+// system as the root, since intermediate files are renamed into the tree.
+func checkTempDir(root string) error {
+	probe, err := os.CreateTemp(tempDir, ".duplicates-probe-")
+	if err != nil {
+		return fmt.Errorf("'%s' is not writable: %w", tempDir, err)
+	}
+	_ = probe.Close()
+	defer os.Remove(probe.Name())
+	dirInfo, err := os.Stat(probe.Name())
+	if err != nil {
+		return err
+	}
+	rootInfo, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	dirDev, ok1 := fileDevice(dirInfo)
+	rootDev, ok2 := fileDevice(rootInfo)
+	if ok1 && ok2 && dirDev != rootDev {
+		return fmt.Errorf("'%s' is not on the same file system as '%s'", tempDir, root)
+	}
+	return nil
+}
+
+// replaceWithLink atomically replaces path with a hard link to target: the
+// link is created under a temporary name, in the -tmpdir or else in the same
+// directory, then renamed over path. path never goes missing, and is left
+// intact when either step fails.
+func replaceWithLink(target, path string) error {
+	dir, base := filepath.Dir(path), filepath.Base(path)
+	if tempDir != "" {
+		dir = tempDir
+	}
+	for attempt := 0; ; attempt++ {
+		tmp := filepath.Join(dir, fmt.Sprintf(".%s.%d-%d.link", base, os.Getpid(), attempt))
+		err := os.Link(target, tmp)
+		if os.IsExist(err) && attempt < 100 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+		return nil
+	}
+}
+
+// linkFile replaces file with a hard link to kept, unless it already is one
+// or the two are on different file systems, where a link can not be made.
+// It reports whether the link was attempted.
+func linkFile(kept, file *WalkedFile) bool {
+	if os.SameFile(kept.file, file.file) {
+		log.WithField("path", file.path()).Debug("Already a hard link to the kept copy")
+		return false
+	}
+	keptDev, ok1 := fileDevice(kept.file)
+	dev, ok2 := fileDevice(file.file)
+	if ok1 && ok2 && keptDev != dev {
+		log.WithFields(log.Fields{
+			"path": file.path(),
+			"kept": kept.path(),
+		}).Warn("Not linking a copy on another file system than the kept one")
+		return false
+	}
+	if dryRun {
+		fmt.Fprintf(statsOutput, "Would link %s to %s\n", file.path(), kept.path())
+		return true
+	}
+	fmt.Fprintf(statsOutput, "Linking %s to %s\n", file.path(), kept.path())
+	if err := replaceWithLink(kept.path(), file.path()); err != nil {
+		fmt.Fprintf(statsOutput, "Error linking file: %s (%s)\n", file.path(), err)
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeCopies creates the kept copy and its duplicate in dir
+func writeCopies(t *testing.T, dir string) (target, path string) {
+	t.Helper()
+	target, path = filepath.Join(dir, "kept.dat"), filepath.Join(dir, "copy.dat")
+	for _, p := range []string{target, path} {
+		if err := os.WriteFile(p, []byte("same content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return target, path
+}
+
+// assertNoTempLinks fails when a temporary link of replaceWithLink is left
+// in dir
+func assertNoTempLinks(t *testing.T, dir string) {
+	t.Helper()
+	links, err := filepath.Glob(filepath.Join(dir, ".*.link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) > 0 {
+		t.Errorf("temporary links left behind: %v", links)
+	}
+}
+
+// assertUnlinked fails unless path still is its own file, with its content
+func assertUnlinked(t *testing.T, target, path string) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("the original file is gone: %s", err)
+	}
+	if string(content) != "same content" {
+		t.Errorf("the original file holds %q", content)
+	}
+	a, errA := os.Stat(target)
+	b, errB := os.Stat(path)
+	if errA == nil && errB == nil && os.SameFile(a, b) {
+		t.Errorf("%s was linked to %s despite the error", path, target)
+	}
+}
+
+func TestReplaceWithLink(t *testing.T) {
+	defer func(dir string) { tempDir = dir }(tempDir)
+	tempDir = ""
+	dir := t.TempDir()
+	target, path := writeCopies(t, dir)
+	if err := replaceWithLink(target, path); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := os.Stat(target)
+	b, _ := os.Stat(path)
+	if !os.SameFile(a, b) {
+		t.Errorf("%s is not a link to %s", path, target)
+	}
+	assertNoTempLinks(t, dir)
+}
+
+func TestReplaceWithLinkFailures(t *testing.T) {
+	defer func(dir string) { tempDir = dir }(tempDir)
+
+	t.Run("link fails in a missing tmpdir", func(t *testing.T) {
+		dir := t.TempDir()
+		target, path := writeCopies(t, dir)
+		tempDir = filepath.Join(dir, "missing")
+		if err := replaceWithLink(target, path); err == nil {
+			t.Fatal("replaceWithLink succeeded without its tmpdir")
+		}
+		assertUnlinked(t, target, path)
+		assertNoTempLinks(t, dir)
+	})
+
+	t.Run("link fails across file systems", func(t *testing.T) {
+		dir := t.TempDir()
+		other, err := os.MkdirTemp("/dev/shm", "duplicates-test-")
+		if err != nil {
+			t.Skip("no /dev/shm to hold a tmpdir on another file system")
+		}
+		defer os.RemoveAll(other)
+		a, _ := os.Stat(dir)
+		b, _ := os.Stat(other)
+		devA, okA := fileDevice(a)
+		devB, okB := fileDevice(b)
+		if !okA || !okB || devA == devB {
+			t.Skip("/dev/shm is on the same file system as the test directory")
+		}
+		target, path := writeCopies(t, dir)
+		tempDir = other
+		if err := replaceWithLink(target, path); err == nil {
+			t.Fatal("replaceWithLink linked across file systems")
+		}
+		assertUnlinked(t, target, path)
+		assertNoTempLinks(t, dir)
+		assertNoTempLinks(t, other)
+	})
+
+	t.Run("rename fails over a directory", func(t *testing.T) {
+		dir := t.TempDir()
+		tempDir = ""
+		target, _ := writeCopies(t, dir)
+		// a non empty directory can not be replaced by a rename
+		path := filepath.Join(dir, "busy")
+		if err := os.MkdirAll(filepath.Join(path, "child"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := replaceWithLink(target, path); err == nil {
+			t.Fatal("replaceWithLink renamed over a directory")
+		}
+		if info, err := os.Stat(filepath.Join(path, "child")); err != nil || !info.IsDir() {
+			t.Errorf("the directory was not left intact: %v", err)
+		}
+		assertNoTempLinks(t, dir)
+	})
+}
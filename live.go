@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// counters of the duplicates found since the last live summary
+var (
+	liveGroups      int64
+	liveReclaimable int64
+)
+
+// recordLiveDuplicate accounts for a file whose content was already seen,
+// newGroup being true when it turns a single file into a duplicate group.
+func recordLiveDuplicate(newGroup bool, size int64) {
+	if newGroup {
+		atomic.AddInt64(&liveGroups, 1)
+	}
+	atomic.AddInt64(&liveReclaimable, size)
+}
+
+// startLiveSummary prints every interval how many duplicate groups were
+// found since the previous summary, instead of letting each group scroll by.
+// The returned function stops the summaries, returning once none can be
+// printed anymore. -nostats leaves them out.
+func startLiveSummary(interval time.Duration) func() {
+	if interval <= 0 || noStats {
+		return func() {}
+	}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				groups := atomic.SwapInt64(&liveGroups, 0)
+				reclaimable := atomic.SwapInt64(&liveReclaimable, 0)
+				fmt.Fprintf(statsOutput, "\nFound %d new duplicate groups in the last %s, %s reclaimable\n", groups, interval, formatSize(reclaimable))
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+}
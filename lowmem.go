@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"hash"
+	"sort"
+)
+
+// lowMemory hashes the candidates one size at a time, writing the groups of
+// a size and forgetting its hashes before moving on to the next one.
+var lowMemory bool
+
+// sizeScan the totals of the groups written by hashBySize
+type sizeScan struct {
+	groups int64
+	copies int
+	// reclaimable the bytes freed by deleting the copies under each root
+	reclaimable []int64
+}
+
+// hashBySize hashes the walked files size by size, from the smallest, and
+// writes the duplicate groups of each size once its files are hashed. Since
+// files of different sizes can not be duplicates, the groups are the same as
+// when every file is hashed at once, but the duplicates map only ever holds
+// the hashes of a single size. It returns the totals of the groups written.
+func hashBySize(newHash func() hash.Hash) *sizeScan {
+	bySize := make(map[int64][]*WalkedFile)
+	var sizes []int64
+	for _, file := range walkFiles {
+		size, ok := contentSize(file)
+		if !ok {
+			// hashed on its own so that the error is reported
+			size = -1
+		}
+		if bySize[size] == nil {
+			sizes = append(sizes, size)
+		}
+		bySize[size] = append(bySize[size], file)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+
+	hashProgress = creatProgress("Scanning %d files ...", &hideProgress)
+	hashProgress.trackBytes(hashingPattern, candidateBytes(walkFiles))
+	hashProgress.details = hashDetails
+	defer hashProgress.delete()
+	defer startProgressEvents(hashProgress, "hash", int64(len(walkFiles)))()
+	walkFiles = nil
+
+	var verified int64
+	scan := &sizeScan{reclaimable: make([]int64, len(roots))}
+	for _, size := range sizes {
+		if interrupted() {
+			break
+		}
+		files := bySize[size]
+		delete(bySize, size)
+		if orderedReads {
+			sortByPath(files)
+		}
+		if checkHashing(hashFiles(files, hashProgress, newHash)); interrupted() {
+			// the groups of this size may be missing copies
+			break
+		}
+
+		groups := collapseHardLinks(collectGroups())
+		duplicates.Lock()
+		duplicates.m = make(map[string][]*WalkedFile)
+		duplicates.Unlock()
+		if verifyContent {
+			verified += int64(len(groups))
+			groups = verifyGroups(groups)
+		}
+		if mixedExtensions {
+			groups = filterMixedExtensions(groups)
+		}
+		groups = filterMinCopies(groups)
+		if len(groups) == 0 {
+			continue
+		}
+		sortGroups(groups)
+		for _, g := range groups {
+			applyKeepStrategy(g)
+			applyKeepMode(g)
+		}
+		for i, freed := range reclaimableByRoot(groups) {
+			scan.reclaimable[i] += freed
+		}
+		_, copies := totalReclaimable(groups)
+		scan.copies += copies
+		scan.groups += int64(len(groups))
+		if !hideProgress {
+			fmt.Fprintln(statsOutput)
+		}
+		writeText(groups)
+	}
+	if verifyContent && !noStats {
+		printVerification(int(verified))
+	}
+	return scan
+}
+
+// printLowMemorySummary reports the groups written by hashBySize
+func printLowMemorySummary(root string, scan *sizeScan) {
+	if noStats {
+		return
+	}
+	printScanRate()
+	if walkTruncated {
+		fmt.Fprintf(statsOutput, "\nPartial results: the walk stopped after %d files (-max-files)", maxFiles)
+	}
+	fmt.Fprintf(statsOutput, "\nFound %d duplicates from %d files in %s with options { size: '%d', name: '%s' }\n", dupCount, fileCount, root, minSize, filenameMatch)
+	var total int64
+	for _, freed := range scan.reclaimable {
+		total += freed
+	}
+	printReclaimable(total, scan.copies, scan.reclaimable)
+	printFailures()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// sizedTree writes files of many sizes, each size held by a few files that
+// come in pairs of copies, and returns them as the walk would.
+func sizedTree(b *testing.B, sizes, perSize int) []*WalkedFile {
+	b.Helper()
+	dir := b.TempDir()
+	var files []*WalkedFile
+	for size := 1; size <= sizes; size++ {
+		for i := 0; i < perSize; i++ {
+			path := filepath.Join(dir, fmt.Sprintf("%d-%d", size, i))
+			content := make([]byte, size)
+			content[0] = byte(i / 2)
+			if err := os.WriteFile(path, content, 0o644); err != nil {
+				b.Fatal(err)
+			}
+			info, err := os.Lstat(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			files = append(files, newWalkedFile(path, info))
+		}
+	}
+	return files
+}
+
+// heapAtGroups records the largest live heap seen when the end of a group
+// is written, where -low-memory still holds the groups of the current size
+type heapAtGroups struct {
+	peak int64
+}
+
+func (h *heapAtGroups) Write(p []byte) (int, error) {
+	if string(p) == "---------\n" {
+		if heap := heapInUse(); heap > h.peak {
+			h.peak = heap
+		}
+	}
+	return len(p), nil
+}
+
+// BenchmarkLowMemory compares the heap held by the hashing state when every
+// file is hashed at once and with -low-memory, which only keeps the hashes
+// and groups of one size. walked-B/op is the heap of the walked files, which
+// both hold in full before hashing, as a size is only complete once the walk
+// is over: the peak with -low-memory is that plus the state of the largest
+// size, not the state of the largest size alone.
+func BenchmarkLowMemory(b *testing.B) {
+	defer func(result, stats io.Writer, hidden bool) {
+		resultOutput, statsOutput, hideProgress = result, stats, hidden
+	}(resultOutput, statsOutput, hideProgress)
+	statsOutput, hideProgress = io.Discard, true
+	roots = []string{b.TempDir()}
+	before := heapInUse()
+	walked := sizedTree(b, 200, 8)
+	walkedHeap := float64(heapInUse() - before)
+
+	b.Run("all-at-once", func(b *testing.B) {
+		resultOutput = io.Discard
+		var total int64
+		for n := 0; n < b.N; n++ {
+			walkFiles = append([]*WalkedFile(nil), walked...)
+			duplicates.m = make(map[string][]*WalkedFile)
+			base := heapInUse()
+			checkHashing(computeHashes(md5.New))
+			groups := collectGroups()
+			total += heapInUse() - base
+			runtime.KeepAlive(groups)
+		}
+		walkFiles, duplicates.m = nil, make(map[string][]*WalkedFile)
+		b.ReportMetric(float64(total)/float64(b.N), "hashing-state-B/op")
+		b.ReportMetric(walkedHeap, "walked-B/op")
+	})
+	b.Run("low-memory", func(b *testing.B) {
+		var total int64
+		for n := 0; n < b.N; n++ {
+			walkFiles = append([]*WalkedFile(nil), walked...)
+			duplicates.m = make(map[string][]*WalkedFile)
+			base := heapInUse()
+			probe := &heapAtGroups{peak: base}
+			resultOutput = probe
+			hashBySize(md5.New)
+			total += probe.peak - base
+		}
+		walkFiles, duplicates.m = nil, make(map[string][]*WalkedFile)
+		b.ReportMetric(float64(total)/float64(b.N), "hashing-state-B/op")
+		b.ReportMetric(walkedHeap, "walked-B/op")
+	})
+}
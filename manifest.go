@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// manifestCache the last manifest fetched from -manifest-url, kept with its
+// ETag so that an unchanged manifest is not downloaded again
+type manifestCache struct {
+	URL      string `json:"url"`
+	ETag     string `json:"etag"`
+	Manifest string `json:"manifest"`
+}
+
+var manifestClient = &http.Client{Timeout: time.Minute}
+
+// fetchManifest returns the hashes listed by the manifest served at url, in
+// the format of loadHashList. With a cache path, the request carries the
+// ETag of the cached manifest, which is used as is when the server answers
+// 304 Not Modified. The cached manifest is also used, with a warning, when
+// the server can not be reached or answers with an error.
+func fetchManifest(url, cachePath string) (map[string]bool, error) {
+	var cached *manifestCache
+	if cachePath != "" {
+		cached = readManifestCache(cachePath, url)
+	}
+	fetched, err := requestManifest(url, cached)
+	if err != nil {
+		if cached == nil {
+			return nil, err
+		}
+		log.WithError(err).Warn("Unable to fetch the manifest, using the cached copy")
+		return parseHashList(strings.NewReader(cached.Manifest))
+	}
+	if fetched == cached {
+		log.WithField("etag", cached.ETag).Debug("Manifest not modified")
+	} else if cachePath != "" {
+		if err := writeManifestCache(cachePath, fetched); err != nil {
+			log.WithError(err).Warn("Unable to write the manifest cache")
+		}
+	}
+	return parseHashList(strings.NewReader(fetched.Manifest))
+}
+
+// requestManifest downloads the manifest, or returns the cached one when the
+// server reports that it did not change.
+func requestManifest(url string, cached *manifestCache) (*manifestCache, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	resp, err := manifestClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		return cached, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &manifestCache{URL: url, ETag: resp.Header.Get("ETag"), Manifest: string(body)}, nil
+}
+
+// readManifestCache returns the cached manifest of url, or nil when there is
+// none or it was fetched from another URL.
+func readManifestCache(path, url string) *manifestCache {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithError(err).Warn("Unable to read the manifest cache")
+		}
+		return nil
+	}
+	var cached manifestCache
+	if err := json.Unmarshal(data, &cached); err != nil {
+		log.WithError(err).Warn("Ignoring a malformed manifest cache")
+		return nil
+	}
+	if cached.URL != url {
+		return nil
+	}
+	return &cached
+}
+
+func writeManifestCache(path string, cached *manifestCache) error {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".duplicates-manifest-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// moveTo the directory receiving the redundant copies, empty when they are
+// not moved
+var moveTo string
+
+// moveDestination returns where a copy is moved, keeping its path relative
+// to the scanned root so that copies with the same name do not collide.
+// When several roots are scanned, the path is placed under a directory named
+// after the root of the copy, since two roots can hold the same paths.
+func moveDestination(file *WalkedFile) string {
+	path := file.path()
+	rel, err := filepath.Rel(roots[file.root], path)
+	if err != nil || rel == "." {
+		rel = filepath.Base(path)
+	}
+	if len(roots) > 1 {
+		rel = filepath.Join(rootLabel(int(file.root)), rel)
+	}
+	return filepath.Join(moveTo, rel)
+}
+
+// rootLabel names a scanned root by its last element, followed by its
+// position among the roots when another root has the same last element.
+func rootLabel(i int) string {
+	name := func(root string) string {
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+		if base := filepath.Base(root); base != string(filepath.Separator) && base != "." {
+			return base
+		}
+		return "root"
+	}
+	label := name(roots[i])
+	for j, other := range roots {
+		if j != i && name(other) == label {
+			return fmt.Sprintf("%s-%d", label, i+1)
+		}
+	}
+	return label
+}
+
+// checkMoveSpace creates the -move-to directory and verifies that its file
+// system has room for the copies that can not simply be renamed into it,
+// so that a move never stops halfway through for lack of space. A dry run
+// checks the closest existing parent of the directory instead of creating it.
+func checkMoveSpace(groups []*DuplicateGroup) error {
+	dest := moveTo
+	if dryRun {
+		dest = existingParent(dest)
+	} else if err := os.MkdirAll(moveTo, 0755); err != nil {
+		return err
+	}
+	destInfo, err := os.Stat(dest)
+	if err != nil {
+		return err
+	}
+	destDev, ok := fileDevice(destInfo)
+	if !ok {
+		return nil
+	}
+	var needed int64
+	for _, g := range groups {
+		for _, file := range g.files[1:] {
+			if dev, ok := fileDevice(file.file); !ok || dev != destDev {
+				needed += file.file.Size()
+			}
+		}
+	}
+	if needed == 0 {
+		return nil
+	}
+	free, ok := freeSpace(dest)
+	if ok && uint64(needed) > free {
+		return fmt.Errorf("moving the duplicates needs %s on the file system of '%s' but only %s are available", formatSize(needed), moveTo, formatSize(int64(free)))
+	}
+	return nil
+}
+
+// existingParent returns path, or its closest parent that exists
+func existingParent(path string) string {
+	for _, err := os.Stat(path); os.IsNotExist(err) && filepath.Dir(path) != path; _, err = os.Stat(path) {
+		path = filepath.Dir(path)
+	}
+	return path
+}
+
+// relocate moves path to dest, copying then removing it when a rename is not
+// possible, across file systems for instance. An existing dest is never
+// overwritten.
+func relocate(path, dest string) error {
+	if _, err := os.Lstat(dest); err == nil {
+		return fmt.Errorf("'%s' already exists", dest)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(path, dest); err == nil {
+		return nil
+	}
+	if err := copyFile(path, dest); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// copyFile copies path to dest through a temporary file, in the -tmpdir or
+// else next to dest, which is synced then renamed to dest. A crash or a full
+// disk during the copy leaves no truncated file at dest that would pass for
+// the moved copy.
+func copyFile(path, dest string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(dest)
+	if tempDir != "" {
+		dir = tempDir
+	}
+	dst, err := os.CreateTemp(dir, "."+filepath.Base(dest)+".*.move")
+	if err != nil {
+		return err
+	}
+	tmp := dst.Name()
+	if err := writeCopy(dst, src, info); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("'%s' already exists", dest)
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// writeCopy fills the temporary file of copyFile with the content, mode and
+// modification time of the source, synced to disk before it is closed.
+func writeCopy(dst *os.File, src io.Reader, info os.FileInfo) error {
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Chmod(info.Mode().Perm()); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst.Name(), info.ModTime(), info.ModTime())
+}
+
+func moveFile(file *WalkedFile) {
+	path, dest := file.path(), moveDestination(file)
+	if dryRun {
+		fmt.Fprintf(statsOutput, "Would move %s to %s\n", path, dest)
+		return
+	}
+	fmt.Fprintf(statsOutput, "Moving %s to %s\n", path, dest)
+	if err := relocate(path, dest); err != nil {
+		fmt.Fprintf(statsOutput, "Error moving file: %s (%s)\n", path, err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+var (
+	ignoreTrailingZeros bool
+	ignoreBOM           bool
+	ignoreWhitespace    bool
+)
+
+// textSniffLength the bytes looked at to tell text files from binary ones
+const textSniffLength = 8000
+
+// isText reports whether the start of r holds no NUL byte, the heuristic
+// of diff and git for telling text from binary content
+func isText(r *bufio.Reader) bool {
+	start, err := r.Peek(textSniffLength)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return false
+	}
+	return bytes.IndexByte(start, 0) < 0
+}
+
+// whitespaceTrimWriter drops the spaces, tabs and carriage returns ending
+// each line, and the blank lines ending the stream, so that text differing
+// only by them hashes the same. Like zeroTrimWriter, what ends the stream
+// is held back and never forwarded.
+type whitespaceTrimWriter struct {
+	w        io.Writer
+	spaces   []byte
+	newlines int
+	out      []byte
+}
+
+func (t *whitespaceTrimWriter) Write(p []byte) (int, error) {
+	t.out = t.out[:0]
+	for _, c := range p {
+		switch c {
+		case ' ', '\t', '\r':
+			t.spaces = append(t.spaces, c)
+		case '\n':
+			t.spaces = t.spaces[:0]
+			t.newlines++
+		default:
+			for ; t.newlines > 0; t.newlines-- {
+				t.out = append(t.out, '\n')
+			}
+			t.out = append(t.out, t.spaces...)
+			t.spaces = t.spaces[:0]
+			t.out = append(t.out, c)
+		}
+	}
+	if _, err := t.w.Write(t.out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// byteOrderMarks the UTF-8, UTF-16BE and UTF-16LE byte order marks. UTF-32
+// is left out as its little endian mark starts like the UTF-16 one.
+var byteOrderMarks = [][]byte{{0xEF, 0xBB, 0xBF}, {0xFE, 0xFF}, {0xFF, 0xFE}}
+
+// skipBOM discards the byte order mark starting r, if any
+func skipBOM(r *bufio.Reader) error {
+	start, err := r.Peek(3)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	for _, bom := range byteOrderMarks {
+		if bytes.HasPrefix(start, bom) {
+			_, err := r.Discard(len(bom))
+			return err
+		}
+	}
+	return nil
+}
+
+var zeros = make([]byte, 32*1024)
+
+// zeroTrimWriter drops the zero bytes ending a stream: runs of zeros are held
+// back and only forwarded once a non zero byte follows them.
+type zeroTrimWriter struct {
+	w       io.Writer
+	pending int64
+}
+
+func (z *zeroTrimWriter) Write(p []byte) (int, error) {
+	last := len(p) - 1
+	for last >= 0 && p[last] == 0 {
+		last--
+	}
+	if last < 0 {
+		z.pending += int64(len(p))
+		return len(p), nil
+	}
+	for z.pending > 0 {
+		n := int64(len(zeros))
+		if z.pending < n {
+			n = z.pending
+		}
+		if _, err := z.w.Write(zeros[:n]); err != nil {
+			return 0, err
+		}
+		z.pending -= n
+	}
+	if _, err := z.w.Write(p[:last+1]); err != nil {
+		return 0, err
+	}
+	z.pending = int64(len(p) - last - 1)
+	return len(p), nil
+}
+
+// normalizedWriter wraps the hash of a file with the content normalizations
+// enabled on the command line.
+func normalizedWriter(w io.Writer) io.Writer {
+	if ignoreTrailingZeros {
+		w = &zeroTrimWriter{w: w}
+	}
+	return w
+}
+
+// approximateHashing reports whether files with different bytes may share a
+// hash, in which case deleting them needs -verify.
+func approximateHashing() bool {
+	return ignoreTrailingZeros || ignoreExif || ignoreBOM || ignoreWhitespace
+}
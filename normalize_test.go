@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestSkipBOM(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		in, want []byte
+	}{
+		{"UTF-8", []byte("\xEF\xBB\xBFtext"), []byte("text")},
+		{"UTF-16LE", []byte("\xFF\xFEt\x00"), []byte("t\x00")},
+		{"UTF-16BE", []byte("\xFE\xFF\x00t"), []byte("\x00t")},
+		{"no BOM", []byte("text"), []byte("text")},
+		{"BOM only", []byte("\xEF\xBB\xBF"), []byte{}},
+		{"shorter than a BOM", []byte("a"), []byte("a")},
+		{"empty", []byte{}, []byte{}},
+		{"partial UTF-8 BOM", []byte("\xEF\xBBtext"), []byte("\xEF\xBBtext")},
+	} {
+		r := bufio.NewReader(bytes.NewReader(tc.in))
+		if err := skipBOM(r); err != nil {
+			t.Errorf("%s: skipBOM: %s", tc.name, err)
+			continue
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("%s: read %q after skipBOM, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// openFile opens a file for hashing
+func openFile(path string) (*os.File, error) {
+	return os.Open(path)
+}
@@ -0,0 +1,36 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxPath the length from which Windows refuses paths without the
+// extended-length prefix
+const maxPath = 260
+
+// openFile opens a file for hashing, using the \\?\ extended-length form for
+// paths longer than MAX_PATH so that deep trees can be hashed.
+func openFile(path string) (*os.File, error) {
+	return os.Open(longPath(path))
+}
+
+// longPath returns path in its extended-length form once it reaches
+// MAX_PATH: \\?\C:\... for a drive path, \\?\UNC\server\share\... for a UNC
+// path. Shorter paths and paths already carrying the prefix are kept.
+func longPath(path string) string {
+	if len(path) < maxPath || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + strings.TrimPrefix(abs, `\\`)
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLongPath(t *testing.T) {
+	deep := strings.Repeat(`directory\`, 30) + "file.dat"
+	for _, tc := range []struct {
+		name, path, want string
+	}{
+		{"short drive path", `C:\data\file.dat`, `C:\data\file.dat`},
+		{"long drive path", `C:\` + deep, `\\?\C:\` + deep},
+		{"long UNC path", `\\server\share\` + deep, `\\?\UNC\server\share\` + deep},
+		{"short UNC path", `\\server\share\file.dat`, `\\server\share\file.dat`},
+		{"prefixed drive path", `\\?\C:\` + deep, `\\?\C:\` + deep},
+		{"prefixed UNC path", `\\?\UNC\server\share\` + deep, `\\?\UNC\server\share\` + deep},
+	} {
+		if got := longPath(tc.path); got != tc.want {
+			t.Errorf("%s: longPath(%q) = %q, want %q", tc.name, tc.path, got, tc.want)
+		}
+	}
+}
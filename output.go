@@ -0,0 +1,667 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// resultOutput receives the listing of the results, the -output file or
+// else stdout
+var resultOutput io.Writer = os.Stdout
+
+// outputFile the -output file, nil when the results go to stdout
+var outputFile *os.File
+
+// openOutput creates or truncates the -output file and sends the results
+// to it. Writes are not buffered, so the file is complete whichever path
+// the program exits on.
+func openOutput(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	outputFile, resultOutput = file, file
+	return nil
+}
+
+// closeOutput closes the -output file, if any, reporting a failed close
+func closeOutput() {
+	if outputFile == nil {
+		return
+	}
+	if err := outputFile.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to write the output file: %s\n", err)
+	}
+	outputFile = nil
+}
+
+// DuplicateGroup a set of files sharing the same content hash
+type DuplicateGroup struct {
+	hash  string
+	files []*WalkedFile
+	// links the other walked hard links to the inode of a member, left out
+	// of files by collapseHardLinks and acted upon along with the member
+	links map[*WalkedFile][]*WalkedFile
+}
+
+// jsonGroup the serialized form of a DuplicateGroup
+type jsonGroup struct {
+	Hash  string   `json:"hash"`
+	Size  int64    `json:"size"`
+	Paths []string `json:"paths"`
+	// Suspects the members separated by -flag-truncated
+	Suspects []string `json:"suspects,omitempty"`
+	// Fingerprint changes whenever a copy is added to or removed from the
+	// group, see groupFingerprint
+	Fingerprint string `json:"fingerprint"`
+	// Empty marks the group of the empty files, which share no content
+	Empty bool `json:"empty,omitempty"`
+}
+
+// groupFingerprint returns the SHA-256 of the content hash of a group
+// followed by the sorted absolute paths of its members. It does not depend
+// on the walk order nor on the display options, so two runs finding the
+// same copies give the same fingerprint.
+func groupFingerprint(g *DuplicateGroup) string {
+	paths := make([]string, len(g.files))
+	for i, file := range g.files {
+		paths[i] = file.path()
+		if abs, err := filepath.Abs(paths[i]); err == nil {
+			paths[i] = abs
+		}
+	}
+	sort.Strings(paths)
+	sum := sha256.New()
+	fmt.Fprintln(sum, g.hash)
+	for _, path := range paths {
+		fmt.Fprintln(sum, path)
+	}
+	return fmt.Sprintf("%x", sum.Sum(nil))
+}
+
+func toJSONGroups(groups []*DuplicateGroup) []jsonGroup {
+	out := make([]jsonGroup, 0, len(groups))
+	for _, g := range groups {
+		paths := make([]string, len(g.files))
+		for i, file := range g.files {
+			paths[i] = reportPath(file.path())
+		}
+		var suspects []string
+		for _, file := range truncatedSuspects[g] {
+			suspects = append(suspects, reportPath(file.path()))
+		}
+		out = append(out, jsonGroup{Hash: g.hash, Size: g.files[0].file.Size(), Paths: paths, Suspects: suspects, Fingerprint: groupFingerprint(g), Empty: emptyGroup(g)})
+	}
+	return out
+}
+
+// writeJSON emits the groups as an indented JSON array
+func writeJSON(w io.Writer, groups []*DuplicateGroup) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(toJSONGroups(groups)); err != nil {
+		log.WithError(err).Error("Failed to write JSON output")
+	}
+}
+
+// writeCSV emits one row per member of each group, under a header row. The
+// group_id numbers the groups from 1 in their listing order, so that the
+// rows of a group can be counted back together.
+func writeCSV(w io.Writer, groups []*DuplicateGroup) {
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"group_id", "hash", "size_bytes", "path"})
+	for i, g := range groups {
+		id, size := strconv.Itoa(i+1), strconv.FormatInt(g.files[0].file.Size(), 10)
+		for _, file := range g.files {
+			_ = out.Write([]string{id, g.hash, size, reportPath(file.path())})
+		}
+	}
+	if out.Flush(); out.Error() != nil {
+		log.WithError(out.Error()).Error("Failed to write CSV output")
+	}
+}
+
+// dirEdge the duplicate content shared by two directories
+type dirEdge struct {
+	from, to string
+	count    int64
+	bytes    int64
+}
+
+func collectGroups() []*DuplicateGroup {
+	duplicates.RLock()
+	defer duplicates.RUnlock()
+	var groups []*DuplicateGroup
+	for hash, files := range duplicates.m {
+		if len(files) > 1 {
+			groups = append(groups, &DuplicateGroup{hash: hash, files: files})
+		}
+	}
+	return groups
+}
+
+// groupOrder the order the groups are listed in: path, by the first path of
+// each group, or size, largest files first
+var groupOrder = "path"
+
+// sortGroups sorts the members of each group lexically by path, then the
+// groups by groupOrder, so that two scans of the same tree list the same
+// groups in the same order and can be diffed. Groups of the same size are
+// ordered by their first path, and empty files come last, apart from the
+// groups sharing content.
+func sortGroups(groups []*DuplicateGroup) {
+	for _, g := range groups {
+		sort.Slice(g.files, func(i, j int) bool { return g.files[i].path() < g.files[j].path() })
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if a, b := emptyGroup(groups[i]), emptyGroup(groups[j]); a != b {
+			return b
+		}
+		if groupOrder == "size" {
+			a, b := memberSize(groups[i].files[0]), memberSize(groups[j].files[0])
+			if a != b {
+				return a > b
+			}
+		}
+		return groups[i].files[0].path() < groups[j].files[0].path()
+	})
+}
+
+// collectUniques returns a single file group for every file whose content
+// was seen exactly once. Files proven unique before hashing have no hash.
+func collectUniques() []*DuplicateGroup {
+	duplicates.RLock()
+	defer duplicates.RUnlock()
+	var groups []*DuplicateGroup
+	for hash, files := range duplicates.m {
+		if len(files) == 1 {
+			groups = append(groups, &DuplicateGroup{hash: hash, files: files})
+		}
+	}
+	for _, file := range prefiltered {
+		groups = append(groups, &DuplicateGroup{files: []*WalkedFile{file}})
+	}
+	return groups
+}
+
+// collapseHardLinks keeps a single member for the files of each group that
+// are hard links to the same inode, since they are one physical file, the
+// other links being recorded with it so that deleting, linking or moving it
+// acts on all of them and frees its bytes. It drops the groups left with a
+// single file.
+func collapseHardLinks(groups []*DuplicateGroup) []*DuplicateGroup {
+	type inode struct{ dev, ino uint64 }
+	var kept []*DuplicateGroup
+	for _, g := range groups {
+		first := make(map[inode]*WalkedFile)
+		collapsed := &DuplicateGroup{hash: g.hash, links: make(map[*WalkedFile][]*WalkedFile)}
+		for _, file := range g.files {
+			if file.ino != 0 {
+				key := inode{file.dev, file.ino}
+				if member, ok := first[key]; ok {
+					log.WithField("path", file.path()).Debug("Collapsing a hard link to a file already in the group")
+					collapsed.links[member] = append(collapsed.links[member], file)
+					continue
+				}
+				first[key] = file
+			}
+			collapsed.files = append(collapsed.files, file)
+		}
+		if len(collapsed.files) > 1 {
+			kept = append(kept, collapsed)
+		}
+	}
+	return kept
+}
+
+// redundantCopies returns the members of a group, after the first, that are
+// not a hard link to an earlier member. Deleting them frees their bytes,
+// while deleting the last but one link to an inode frees nothing.
+func redundantCopies(g *DuplicateGroup) []*WalkedFile {
+	var copies []*WalkedFile
+files:
+	for i, file := range g.files[1:] {
+		for _, earlier := range g.files[:i+1] {
+			if os.SameFile(earlier.file, file.file) {
+				continue files
+			}
+		}
+		copies = append(copies, file)
+	}
+	return copies
+}
+
+// totalReclaimable returns the bytes freed by deleting the redundant copies
+// of every group, and the number of those copies.
+func totalReclaimable(groups []*DuplicateGroup) (bytes int64, copies int) {
+	for _, g := range groups {
+		for _, file := range redundantCopies(g) {
+			bytes += file.file.Size()
+			copies++
+		}
+	}
+	return bytes, copies
+}
+
+// printReclaimable reports the total reclaimable space and, when several
+// roots were scanned, the share of each root.
+func printReclaimable(total int64, copies int, byRoot []int64) {
+	fmt.Fprintf(statsOutput, "Reclaimable: %s in %d redundant copies\n", formatSize(total), copies)
+	if len(roots) < 2 {
+		return
+	}
+	for i, reclaimable := range byRoot {
+		fmt.Fprintf(statsOutput, "Reclaimable in %s: %s\n", roots[i], formatSize(reclaimable))
+	}
+}
+
+// reclaimableByRoot returns, for each scanned root, the bytes freed by
+// deleting the copies found under it, the first file of a group being kept
+// and hard links to the same inode counting once.
+func reclaimableByRoot(groups []*DuplicateGroup) []int64 {
+	reclaimable := make([]int64, len(roots))
+	for _, g := range groups {
+		for _, file := range redundantCopies(g) {
+			reclaimable[file.root] += file.file.Size()
+		}
+	}
+	return reclaimable
+}
+
+// groupExtensions returns the distinct extensions of the members of a group
+func groupExtensions(g *DuplicateGroup) []string {
+	seen := make(map[string]bool)
+	var exts []string
+	for _, file := range g.files {
+		ext := filepath.Ext(file.file.Name())
+		if ext == "" {
+			ext = "(none)"
+		}
+		if !seen[ext] {
+			seen[ext] = true
+			exts = append(exts, ext)
+		}
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// filterMixedExtensions keeps the groups whose copies were saved under at
+// least two different extensions.
+func filterMixedExtensions(groups []*DuplicateGroup) []*DuplicateGroup {
+	var kept []*DuplicateGroup
+	for _, g := range groups {
+		if len(groupExtensions(g)) > 1 {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// emptyGroup reports whether a group is made of empty files, listed with
+// -ignore-empty=false
+func emptyGroup(g *DuplicateGroup) bool {
+	return len(g.files) > 0 && memberSize(g.files[0]) == 0
+}
+
+// minCopies the number of copies a group needs to be reported
+var minCopies = 2
+
+// filterMinCopies keeps the groups of at least minCopies files
+func filterMinCopies(groups []*DuplicateGroup) []*DuplicateGroup {
+	if minCopies <= 2 {
+		return groups
+	}
+	var kept []*DuplicateGroup
+	for _, g := range groups {
+		if len(g.files) >= minCopies {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// underPath reports whether path is dir or lies below it
+func underPath(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// filterBoundary keeps the groups having members under both directories,
+// given as absolute paths.
+func filterBoundary(groups []*DuplicateGroup, a, b string) []*DuplicateGroup {
+	var kept []*DuplicateGroup
+	for _, g := range groups {
+		inA, inB := false, false
+		for _, file := range g.files {
+			path := file.path()
+			if abs, err := filepath.Abs(path); err == nil {
+				path = abs
+			}
+			inA = inA || underPath(path, a)
+			inB = inB || underPath(path, b)
+		}
+		if inA && inB {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// limitByModTime keeps the n groups whose files were modified most recently,
+// ranked by their newest member, or with oldest the n groups ranked by their
+// oldest member. The kept groups are sorted in that order.
+func limitByModTime(groups []*DuplicateGroup, n int, oldest bool) []*DuplicateGroup {
+	rank := make(map[*DuplicateGroup]time.Time, len(groups))
+	for _, g := range groups {
+		t := g.files[0].file.ModTime()
+		for _, file := range g.files[1:] {
+			mod := file.file.ModTime()
+			if (oldest && mod.Before(t)) || (!oldest && mod.After(t)) {
+				t = mod
+			}
+		}
+		rank[g] = t
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if oldest {
+			return rank[groups[i]].Before(rank[groups[j]])
+		}
+		return rank[groups[i]].After(rank[groups[j]])
+	})
+	if len(groups) > n {
+		groups = groups[:n]
+	}
+	return groups
+}
+
+// resolvePathPrefix settles the prefix stripped by displayPath, detecting
+// the longest common directory of all the groups when asked to.
+func resolvePathPrefix(groups []*DuplicateGroup) {
+	if absolutePath || trimPrefix != "auto" {
+		return
+	}
+	trimPrefix = ""
+	var common []string
+	for i, g := range groups {
+		for j, file := range g.files {
+			dir := strings.Split(filepath.Dir(file.path()), string(filepath.Separator))
+			if i == 0 && j == 0 {
+				common = dir
+				continue
+			}
+			n := 0
+			for n < len(common) && n < len(dir) && common[n] == dir[n] {
+				n++
+			}
+			common = common[:n]
+		}
+	}
+	if len(common) == 0 {
+		return
+	}
+	trimPrefix = strings.Join(common, string(filepath.Separator)) + string(filepath.Separator)
+	if trimPrefix == string(filepath.Separator) {
+		trimPrefix = ""
+		return
+	}
+	if !noStats {
+		fmt.Fprintf(statsOutput, "\nPaths are displayed relative to '%s'\n", trimPrefix)
+	}
+}
+
+// reportPath returns the path of a file in the JSON reports, absolute unless
+// -trim-prefix asks for paths relative to a prefix. The prefix of
+// -trim-prefix auto is only settled once every group is known, so -sink
+// streams absolute paths before.
+func reportPath(path string) string {
+	if trimPrefix == "" || trimPrefix == "auto" {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	return displayPath(path)
+}
+
+func displayPath(path string) string {
+	if absolutePath {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	} else {
+		path = strings.TrimPrefix(path, trimPrefix)
+	}
+	return encodePath(path)
+}
+
+// encodePath applies -path-encoding: ascii-escape writes the bytes that are
+// not printable ASCII as \xHH (and backslashes as \\), percent writes them
+// as %HH (and '%' as %25). Both can be decoded back to the original bytes.
+func encodePath(path string) string {
+	if pathEncoding == "utf8" {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case pathEncoding == "ascii-escape" && c == '\\':
+			b.WriteString(`\\`)
+		case pathEncoding == "percent" && c == '%':
+			b.WriteString("%25")
+		case c < 0x20 || c >= 0x7f:
+			if pathEncoding == "percent" {
+				fmt.Fprintf(&b, "%%%02X", c)
+			} else {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// abbreviatePaths shortens each path to its last components, as few as
+// needed to tell it apart from the other paths, like "a/x.txt" and
+// "b/x.txt" for "/data/a/x.txt" and "/data/b/x.txt".
+func abbreviatePaths(paths []string) []string {
+	parts := make([][]string, len(paths))
+	for i, path := range paths {
+		parts[i] = strings.Split(path, string(filepath.Separator))
+	}
+	short := make([]string, len(paths))
+	for i := range paths {
+		for n := 1; n <= len(parts[i]); n++ {
+			suffix := strings.Join(parts[i][len(parts[i])-n:], string(filepath.Separator))
+			unique := true
+			for j := range paths {
+				if j != i && (suffix == paths[j] || strings.HasSuffix(paths[j], string(filepath.Separator)+suffix)) {
+					unique = false
+					break
+				}
+			}
+			if unique || n == len(parts[i]) {
+				short[i] = suffix
+				break
+			}
+		}
+	}
+	return short
+}
+
+// findGroup returns the file given to -find followed by its copies found
+// during the scan, or nothing when there is no copy.
+func findGroup() []*DuplicateGroup {
+	duplicates.RLock()
+	defer duplicates.RUnlock()
+	group := &DuplicateGroup{hash: findHash, files: []*WalkedFile{newWalkedFile(findFile, findInfo)}}
+	for _, file := range duplicates.m[findHash] {
+		if !os.SameFile(file.file, findInfo) {
+			group.files = append(group.files, file)
+		}
+	}
+	if len(group.files) < 2 {
+		return nil
+	}
+	return []*DuplicateGroup{group}
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// writeText prints each group as a list of paths followed by a separator,
+// deleting or linking every copy but the first one in delete and hardlink
+// modes.
+func writeText(groups []*DuplicateGroup) {
+	for _, g := range groups {
+		if uniquesMode {
+			fmt.Fprintf(resultOutput, "%s\n", displayPath(g.files[0].path()))
+			continue
+		}
+		if emptyGroup(g) {
+			fmt.Fprintln(resultOutput, "Empty files:")
+		}
+		if interactive && !interactiveQuit {
+			promptGroup(g)
+			continue
+		}
+		mixed := attributesDiffer(g)
+		paths := make([]string, len(g.files))
+		for i, file := range g.files {
+			paths[i] = displayPath(file.path())
+		}
+		if abbrevPaths {
+			paths = abbreviatePaths(paths)
+		}
+		for i, file := range g.files {
+			label, suffix := "", ""
+			if deleteMode && !interactive {
+				label = "KEEP: "
+			}
+			acted := false
+			if i > 0 && actionMode() && !interactive {
+				label, suffix, acted = actOnListed(g, file, label, " (dup of "+paths[0]+")")
+			}
+			if !acted || deleteMode {
+				if mixed {
+					fmt.Fprintf(resultOutput, "%s%s (%s)%s\n", label, paths[i], describeAttributes(file.file), suffix)
+				} else {
+					fmt.Fprintf(resultOutput, "%s%s%s\n", label, paths[i], suffix)
+				}
+			}
+			if !acted {
+				continue
+			}
+			// the other links to the copy, which would keep its bytes
+			for _, link := range g.links[file] {
+				if label, suffix, _ := actOnListed(g, link, "KEEP: ", " (link to "+paths[i]+")"); deleteMode {
+					fmt.Fprintf(resultOutput, "%s%s%s\n", label, displayPath(link.path()), suffix)
+				}
+			}
+		}
+		for _, file := range truncatedSuspects[g] {
+			fmt.Fprintf(resultOutput, "%s (%s)\n", displayPath(file.path()), describeSuspect(g, file))
+		}
+		if mixedExtensions {
+			fmt.Fprintf(resultOutput, "Extensions: %s\n", strings.Join(groupExtensions(g), ", "))
+		}
+		fmt.Fprintln(resultOutput, "---------")
+	}
+}
+
+// actOnListed acts on a path of a redundant copy listed by writeText, which
+// labels the deletions itself, and returns the label and suffix to list it
+// with: those given when it was not acted upon.
+func actOnListed(g *DuplicateGroup, file *WalkedFile, label, suffix string) (string, string, bool) {
+	failed := failedDeletes
+	labeledDeletions = deleteMode
+	acted := actOnCopy(g, file)
+	labeledDeletions = false
+	if !acted {
+		return label, "", false
+	}
+	return deletionLabel(failedDeletes > failed), suffix, true
+}
+
+// deletionLabel marks a copy removed by -delete, or that would be with
+// -dry-run, in the listing where the copy kept is marked "KEEP: "
+func deletionLabel(failed bool) string {
+	if failed {
+		return "DELETE FAILED: "
+	}
+	return "DELETE: "
+}
+
+// writeDot emits a Graphviz graph where nodes are directories holding
+// duplicates and edges link directories sharing the same content.
+func writeDot(w io.Writer, groups []*DuplicateGroup) {
+	nodes := make(map[string]bool)
+	edges := make(map[[2]string]*dirEdge)
+	for _, g := range groups {
+		dirs := make([]string, len(g.files))
+		for i, file := range g.files {
+			dirs[i] = filepath.Dir(displayPath(file.path()))
+			nodes[dirs[i]] = true
+		}
+		size := g.files[0].file.Size()
+		for i := 0; i < len(dirs); i++ {
+			for j := i + 1; j < len(dirs); j++ {
+				if dirs[i] == dirs[j] {
+					continue
+				}
+				key := [2]string{dirs[i], dirs[j]}
+				if key[0] > key[1] {
+					key[0], key[1] = key[1], key[0]
+				}
+				edge, ok := edges[key]
+				if !ok {
+					edge = &dirEdge{from: key[0], to: key[1]}
+					edges[key] = edge
+				}
+				edge.count++
+				edge.bytes += size
+			}
+		}
+	}
+
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sorted := make([]*dirEdge, 0, len(edges))
+	for _, edge := range edges {
+		sorted = append(sorted, edge)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].from != sorted[j].from {
+			return sorted[i].from < sorted[j].from
+		}
+		return sorted[i].to < sorted[j].to
+	})
+
+	fmt.Fprintln(w, "graph duplicates {")
+	fmt.Fprintln(w, "  node [shape=folder];")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s;\n", dotQuote(name))
+	}
+	for _, edge := range sorted {
+		fmt.Fprintf(w, "  %s -- %s [weight=%d, label=%s];\n",
+			dotQuote(edge.from), dotQuote(edge.to), edge.count,
+			dotQuote(fmt.Sprintf("%d files, %d bytes", edge.count, edge.bytes)))
+	}
+	fmt.Fprintln(w, "}")
+}
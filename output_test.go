@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCollapseHardLinks checks that the links to a member are kept with it,
+// so that acting on the member acts on every path holding its bytes.
+func TestCollapseHardLinks(t *testing.T) {
+	dir := t.TempDir()
+	target, path := writeCopies(t, dir)
+	link := filepath.Join(dir, "link.dat")
+	if err := os.Link(path, link); err != nil {
+		t.Skip("hard links are not supported:", err)
+	}
+	var files []*WalkedFile
+	for _, p := range []string{target, path, link} {
+		info, err := os.Lstat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, newWalkedFile(p, info))
+	}
+	if files[2].ino == 0 {
+		t.Skip("the platform does not tell the inodes")
+	}
+	groups := collapseHardLinks([]*DuplicateGroup{{hash: "h", files: files}})
+	if len(groups) != 1 || len(groups[0].files) != 2 {
+		t.Fatalf("collapseHardLinks = %v, want a group of 2 members", groups)
+	}
+	g := groups[0]
+	if links := g.links[files[1]]; len(links) != 1 || links[0] != files[2] {
+		t.Errorf("links of %s = %v, want %s", path, links, link)
+	}
+
+	defer func(d, dry bool, w io.Writer) { deleteMode, dryRun, statsOutput = d, dry, w }(deleteMode, dryRun, statsOutput)
+	deleteMode, dryRun, statsOutput = true, false, io.Discard
+	if !actOnDuplicate(g, files[1]) {
+		t.Fatal("the copy was not deleted")
+	}
+	for _, p := range []string{path, link} {
+		if _, err := os.Lstat(p); !os.IsNotExist(err) {
+			t.Errorf("%s was not deleted along with its link: %v", p, err)
+		}
+	}
+	if _, err := os.Lstat(target); err != nil {
+		t.Errorf("the kept copy is gone: %s", err)
+	}
+}
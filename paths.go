@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// pathTable interns the directories of the walked files, so a directory
+// holding thousands of files is stored once instead of once per file path.
+type pathTable struct {
+	sync.RWMutex
+	dirs  []string
+	index map[string]int32
+}
+
+var walkedDirs = &pathTable{index: make(map[string]int32)}
+
+func (t *pathTable) intern(dir string) int32 {
+	t.RLock()
+	i, ok := t.index[dir]
+	t.RUnlock()
+	if ok {
+		return i
+	}
+	t.Lock()
+	defer t.Unlock()
+	if i, ok = t.index[dir]; ok {
+		return i
+	}
+	i = int32(len(t.dirs))
+	t.dirs = append(t.dirs, dir)
+	t.index[dir] = i
+	return i
+}
+
+func (t *pathTable) dir(i int32) string {
+	t.RLock()
+	defer t.RUnlock()
+	return t.dirs[i]
+}
+
+func newWalkedFile(path string, f os.FileInfo) *WalkedFile {
+	walked := &WalkedFile{dir: walkedDirs.intern(filepath.Dir(path)), root: currentRoot, file: f}
+	walked.dev, walked.ino, _ = fileInode(f)
+	return walked
+}
+
+// path rebuilds the full path of the file from its interned directory and
+// the name already held by its os.FileInfo.
+func (w *WalkedFile) path() string {
+	return filepath.Join(walkedDirs.dir(w.dir), w.file.Name())
+}
+
+// walkedFolded holds the case folded paths already walked with -ignore-case-fs
+var walkedFolded = make(map[string]bool)
+
+// seenFolded reports whether a path differing only by case was already
+// walked, recording it otherwise.
+func seenFolded(path string) bool {
+	folded := strings.ToLower(path)
+	if walkedFolded[folded] {
+		return true
+	}
+	walkedFolded[folded] = true
+	return false
+}
+
+// canonicalCase returns the path with each component spelled as it is stored
+// on disk, so paths given with another casing on a case-insensitive file
+// system are reported the same way as the walk reports them.
+func canonicalCase(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	volume := filepath.VolumeName(abs)
+	canonical := volume + string(filepath.Separator)
+	for _, name := range strings.Split(strings.TrimPrefix(abs[len(volume):], string(filepath.Separator)), string(filepath.Separator)) {
+		if name == "" {
+			continue
+		}
+		entries, err := os.ReadDir(canonical)
+		if err == nil {
+			for _, entry := range entries {
+				if entry.Name() != name && strings.EqualFold(entry.Name(), name) {
+					name = entry.Name()
+					break
+				}
+			}
+		}
+		canonical = filepath.Join(canonical, name)
+	}
+	return canonical
+}
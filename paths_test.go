@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestSeenFolded walks paths of a case-insensitive file system, where
+// differing casings name the same file, which must be hashed once.
+func TestSeenFolded(t *testing.T) {
+	walkedFolded = make(map[string]bool)
+	defer func() { walkedFolded = make(map[string]bool) }()
+	for _, tc := range []struct {
+		path string
+		seen bool
+	}{
+		{"/photos/A.txt", false},
+		{"/photos/a.txt", true},
+		{"/PHOTOS/a.TXT", true},
+		{"/photos/b.txt", false},
+		{"/photos/Photo.JPG", false},
+		{"/photos/photo.jpg", true},
+	} {
+		if seen := seenFolded(tc.path); seen != tc.seen {
+			t.Errorf("seenFolded(%q) = %v, want %v", tc.path, seen, tc.seen)
+		}
+	}
+}
+
+// TestCanonicalCase checks that a root given with another casing is reported
+// with the casing stored on disk.
+func TestCanonicalCase(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "Photos"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Photos", "Photo.JPG"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path, want string
+	}{
+		{filepath.Join(dir, "photos", "photo.jpg"), filepath.Join(dir, "Photos", "Photo.JPG")},
+		{filepath.Join(dir, "Photos", "Photo.JPG"), filepath.Join(dir, "Photos", "Photo.JPG")},
+		// a missing name keeps its casing
+		{filepath.Join(dir, "photos", "missing.jpg"), filepath.Join(dir, "Photos", "missing.jpg")},
+	} {
+		if got := canonicalCase(tc.path); got != tc.want {
+			t.Errorf("canonicalCase(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+// deepTree lists the paths of a tree 16 directories deep, each level holding
+// 200 files, as the walk would find them.
+func deepTree() []string {
+	var paths []string
+	dir := string(filepath.Separator) + "data"
+	for depth := 0; depth < 16; depth++ {
+		dir = filepath.Join(dir, fmt.Sprintf("directory-level-%02d", depth))
+		for i := 0; i < 200; i++ {
+			paths = append(paths, filepath.Join(dir, fmt.Sprintf("file-%03d.dat", i)))
+		}
+	}
+	return paths
+}
+
+// BenchmarkPathTable compares the memory kept for the paths of a deep tree
+// when the directories are interned, as newWalkedFile does, with full path
+// strings. retained-B/op is the heap still held once the paths are stored,
+// B/op also counting the garbage of the lookups.
+func BenchmarkPathTable(b *testing.B) {
+	paths := deepTree()
+	type entry struct {
+		dir  int32
+		name string
+	}
+	b.Run("interned", func(b *testing.B) {
+		b.ReportAllocs()
+		var retained int64
+		for n := 0; n < b.N; n++ {
+			before := heapInUse()
+			table := &pathTable{index: make(map[string]int32)}
+			entries := make([]entry, len(paths))
+			for i, path := range paths {
+				// fresh strings, as the walk gets them
+				dir, name := string([]byte(filepath.Dir(path))), string([]byte(filepath.Base(path)))
+				entries[i] = entry{table.intern(dir), name}
+			}
+			retained += heapInUse() - before
+			runtime.KeepAlive(table)
+			runtime.KeepAlive(entries)
+		}
+		b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+	})
+	b.Run("plain", func(b *testing.B) {
+		b.ReportAllocs()
+		var retained int64
+		for n := 0; n < b.N; n++ {
+			before := heapInUse()
+			full := make([]string, len(paths))
+			for i, path := range paths {
+				full[i] = string([]byte(path))
+			}
+			retained += heapInUse() - before
+			runtime.KeepAlive(full)
+		}
+		b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+	})
+}
+
+// heapInUse returns the bytes of the live heap once collected
+func heapInUse() int64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return int64(stats.HeapAlloc)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math/bits"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"duplicates/dedup"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// perceptual groups the images that look alike, resized or encoded
+	// again, apart from the exact duplicates
+	perceptual bool
+	// perceptualDistance the largest number of bits two difference hashes
+	// of near-duplicate images differ by, out of 64
+	perceptualDistance = 5
+	// perceptualImages the images seen by hashImages
+	perceptualImages int64
+)
+
+// imageExtensions the images decoded for -perceptual
+var imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+func isImage(file *WalkedFile) bool {
+	return imageExtensions[strings.ToLower(filepath.Ext(file.file.Name()))]
+}
+
+// differenceHash returns the dHash of an image: the image shrunk to 9x8
+// gray cells, each bit telling whether a cell is brighter than the next
+// one on its row. Resizing, compressing or converting an image barely
+// changes it, unlike its bytes.
+func differenceHash(img image.Image) uint64 {
+	var cells [8][9]float64
+	b := img.Bounds()
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 9; x++ {
+			cells[y][x] = cellLuma(img, image.Rect(
+				b.Min.X+x*b.Dx()/9, b.Min.Y+y*b.Dy()/8,
+				b.Min.X+(x+1)*b.Dx()/9, b.Min.Y+(y+1)*b.Dy()/8))
+		}
+	}
+	var sum uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			sum <<= 1
+			if cells[y][x] > cells[y][x+1] {
+				sum |= 1
+			}
+		}
+	}
+	return sum
+}
+
+// cellLuma averages the luma of a cell, sampling at most 8x8 of its pixels
+func cellLuma(img image.Image, cell image.Rectangle) float64 {
+	if cell.Empty() {
+		cell.Max = cell.Min.Add(image.Pt(1, 1))
+	}
+	stepX, stepY := (cell.Dx()+7)/8, (cell.Dy()+7)/8
+	var total float64
+	var n int
+	for y := cell.Min.Y; y < cell.Max.Y; y += stepY {
+		for x := cell.Min.X; x < cell.Max.X; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			total += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			n++
+		}
+	}
+	return total / float64(n)
+}
+
+// imageHash a walked image with its difference hash, ok once decoded
+type imageHash struct {
+	file *WalkedFile
+	hash uint64
+	ok   bool
+}
+
+// hashImages decodes the walked images with a pool of workers and returns
+// their difference hashes. It runs before the prefilter, which drops the
+// files of a unique size that a resized copy has. Images that can not be
+// decoded are skipped.
+func hashImages(files []*WalkedFile) []imageHash {
+	var images []*WalkedFile
+	for _, file := range files {
+		if isImage(file) {
+			images = append(images, file)
+		}
+	}
+	hashes := make([]imageHash, len(images))
+	pool := dedup.NewPool(scanContext, workerCount(), streamBacklog, nil, func(_ int, _ hash.Hash, i int) {
+		hashes[i].file = images[i]
+		img, err := decodeImage(images[i].path())
+		if err == errImageTooLarge {
+			log.WithField("path", images[i].path()).Warnf("Skipping an image of more than %d pixels", maxImagePixels)
+			return
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path":  images[i].path(),
+				"error": err,
+			}).Debug("Unable to decode image")
+			return
+		}
+		hashes[i].hash, hashes[i].ok = differenceHash(img), true
+		atomic.AddInt64(&perceptualImages, 1)
+	})
+	for i := range images {
+		if !pool.Send(i) {
+			break
+		}
+	}
+	_ = pool.Close()
+	var decoded []imageHash
+	for _, h := range hashes {
+		if h.ok {
+			decoded = append(decoded, h)
+		}
+	}
+	return decoded
+}
+
+// maxImagePixels the largest image decoded by -perceptual. A decoded image
+// takes 4 to 8 bytes a pixel, each worker holding one, while the header of
+// a small crafted file can declare billions of pixels.
+const maxImagePixels = 50_000_000
+
+var errImageTooLarge = errors.New("image too large")
+
+// decodeImage decodes an image once its header tells it is no larger than
+// maxImagePixels, returning errImageTooLarge otherwise.
+func decodeImage(path string) (image.Image, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r := bufio.NewReader(throttle(file))
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return nil, errImageTooLarge
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r.Reset(throttle(file))
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// nearDuplicates clusters the images whose hashes differ by at most
+// perceptualDistance bits, transitively. Comparing every pair is quadratic
+// in the number of images. Clusters whose images are all copies of one of
+// the exact groups are left out, being listed already.
+func nearDuplicates(images []imageHash, groups []*DuplicateGroup) [][]*WalkedFile {
+	parent := make([]int, len(images))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range images {
+		for j := i + 1; j < len(images); j++ {
+			if bits.OnesCount64(images[i].hash^images[j].hash) <= perceptualDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+	members := make(map[int][]*WalkedFile)
+	for i, h := range images {
+		members[find(i)] = append(members[find(i)], h.file)
+	}
+	exact := make(map[*WalkedFile]*DuplicateGroup)
+	for _, g := range groups {
+		for _, file := range g.files {
+			exact[file] = g
+		}
+	}
+	var clusters [][]*WalkedFile
+	for _, files := range members {
+		if len(files) < 2 || sameGroup(files, exact) {
+			continue
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].path() < files[j].path() })
+		clusters = append(clusters, files)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i][0].path() < clusters[j][0].path() })
+	return clusters
+}
+
+// sameGroup reports whether the files are all members of one exact group
+func sameGroup(files []*WalkedFile, exact map[*WalkedFile]*DuplicateGroup) bool {
+	g := exact[files[0]]
+	if g == nil {
+		return false
+	}
+	for _, file := range files[1:] {
+		if exact[file] != g {
+			return false
+		}
+	}
+	return true
+}
+
+// writeNearDuplicates lists the clusters of near-duplicate images after the
+// exact groups
+func writeNearDuplicates(clusters [][]*WalkedFile) {
+	if len(clusters) == 0 {
+		return
+	}
+	fmt.Fprintln(resultOutput, "Near-duplicate images:")
+	for _, files := range clusters {
+		for _, file := range files {
+			fmt.Fprintf(resultOutput, "%s\n", displayPath(file.path()))
+		}
+		fmt.Fprintln(resultOutput, "---------")
+	}
+}
+
+func printNearDuplicates(clusters [][]*WalkedFile) {
+	fmt.Fprintf(statsOutput, "Found %d clusters of near-duplicate images among %d images (distance %d)\n", len(clusters), atomic.LoadInt64(&perceptualImages), perceptualDistance)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestDecodeImageTooLarge checks that an image whose header declares more
+// than maxImagePixels is refused before it is decoded.
+func TestDecodeImageTooLarge(t *testing.T) {
+	var small bytes.Buffer
+	if err := gif.Encode(&small, image.NewPaletted(image.Rect(0, 0, 1, 1), []color.Color{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	smallPath := filepath.Join(dir, "small.gif")
+	if err := os.WriteFile(smallPath, small.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// the logical screen of a GIF, after its 6 byte signature, declares
+	// 65535x65535 pixels
+	large := append([]byte(nil), small.Bytes()...)
+	copy(large[6:10], []byte{0xff, 0xff, 0xff, 0xff})
+	largePath := filepath.Join(dir, "large.gif")
+	if err := os.WriteFile(largePath, large, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if img, err := decodeImage(smallPath); err != nil || img.Bounds().Dx() != 1 {
+		t.Errorf("decodeImage(small.gif) = %v, %v, want a 1x1 image", img, err)
+	}
+	if _, err := decodeImage(largePath); err != errImageTooLarge {
+		t.Errorf("decodeImage(large.gif) = %v, want %v", err, errImageTooLarge)
+	}
+}
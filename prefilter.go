@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// prefiltered holds the walked files proven unique without being hashed
+var prefiltered []*WalkedFile
+
+// tailFirst makes the prefilter sample the end of files instead of their
+// start, which is where append-only files differ.
+var tailFirst bool
+
+// readSampleByte returns the first byte of a file, or its last one with
+// -tail-first, ok being false when it could not be read.
+func readSampleByte(path string, size int64) (b byte, ok bool) {
+	file, err := openFile(path)
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+	offset := int64(0)
+	if tailFirst {
+		offset = size - 1
+	}
+	var buf [1]byte
+	if n, _ := file.ReadAt(buf[:], offset); n != 1 {
+		return 0, false
+	}
+	return buf[0], true
+}
+
+// contentSize returns the size of the content that is hashed for a walked
+// file, which for a symbolic link is the size of its target.
+func contentSize(file *WalkedFile) (int64, bool) {
+	if file.file.Mode()&os.ModeSymlink == 0 {
+		return file.file.Size(), true
+	}
+	target, err := os.Stat(file.path())
+	if err != nil || target.IsDir() {
+		return 0, false
+	}
+	return target.Size(), true
+}
+
+// prefilterCandidates splits the walked files between the ones that may have
+// a duplicate and the ones that can not: files are bucketed by size, and the
+// files sharing a size are split again by their first (or last) byte, a
+// single byte read, before any of them gets hashed. Only the buckets of two
+// files or more are hashed, and since files of different sizes or first
+// bytes can not be duplicates, the groups found are the same as when every
+// file is hashed. Files that could not be read stay candidates so that the
+// hashing phase reports the error, as do the files of the cachedSizes.
+func prefilterCandidates(files []*WalkedFile) (candidates, unique []*WalkedFile) {
+	bySize := make(map[int64][]*WalkedFile)
+	var sizes []int64
+	for _, file := range files {
+		size, ok := contentSize(file)
+		if !ok {
+			candidates = append(candidates, file)
+			continue
+		}
+		if bySize[size] == nil {
+			sizes = append(sizes, size)
+		}
+		bySize[size] = append(bySize[size], file)
+	}
+	cached := cachedSizes(files)
+	for _, size := range sizes {
+		bucket := bySize[size]
+		if len(bucket) < 2 {
+			unique = append(unique, bucket...)
+			continue
+		}
+		if size == 0 || cached[size] {
+			candidates = append(candidates, bucket...)
+			continue
+		}
+		bySample := make(map[byte][]*WalkedFile)
+		for _, member := range bucket {
+			sample, ok := readSampleByte(member.path(), size)
+			if !ok {
+				candidates = append(candidates, member)
+				continue
+			}
+			bySample[sample] = append(bySample[sample], member)
+		}
+		for _, split := range bySample {
+			if len(split) < 2 {
+				unique = append(unique, split...)
+			} else {
+				candidates = append(candidates, split...)
+			}
+		}
+	}
+	atomic.AddInt64(&fileCount, int64(len(unique)))
+	atomic.AddInt64(&scannedBytes, candidateBytes(unique))
+	log.WithFields(log.Fields{
+		"candidates": len(candidates),
+		"unique":     len(unique),
+	}).Debug("Prefiltered walked files")
+	return candidates, unique
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/md5"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestPrefilterCached checks that the files of a size holding a file whose
+// cached hash is valid are left to the hashing instead of being read by the
+// prefilter and the prehash.
+func TestPrefilterCached(t *testing.T) {
+	defer func(c *hashCache) { cache = c }(cache)
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	var files []*WalkedFile
+	// the same size, different first bytes
+	for _, name := range []string{"a.dat", "b.dat"} {
+		path := filepath.Join(dir, name)
+		content := make([]byte, 2*prehashBytes)
+		content[0] = name[0]
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, newWalkedFile(path, info))
+	}
+
+	cache = nil
+	if candidates, _ := prefilterCandidates(files); len(candidates) != 0 {
+		t.Fatalf("without a cache the prefilter kept %d candidates, want none", len(candidates))
+	}
+
+	cache = &hashCache{scanned: time.Now(), entries: make(map[string]cacheEntry), walked: make(map[string]bool)}
+	cache.store(files[0].path(), files[0].file, "cached")
+	candidates, unique := prefilterCandidates(files)
+	if len(candidates) != 2 || len(unique) != 0 {
+		t.Errorf("with a cached file the prefilter kept %d candidates and %d unique files, want 2 and 0", len(candidates), len(unique))
+	}
+	candidates, unique = prehashCandidates(files, md5.New)
+	if len(candidates) != 2 || len(unique) != 0 {
+		t.Errorf("with a cached file the prehash kept %d candidates and %d unique files, want 2 and 0", len(candidates), len(unique))
+	}
+	if cache.reused != 0 {
+		t.Errorf("the prefilter counted %d cached hashes as reused", cache.reused)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"runtime"
+	"sync/atomic"
+
+	"duplicates/dedup"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// prehashBytes the leading bytes hashed to split the candidates of a size,
+// before any full hash; 0 disables this stage
+var prehashBytes int64 = 4096
+
+// workers the number of workers of a hashing round given by -workers, 0
+// for one per CPU
+var workers int
+
+// workerCount returns the number of workers of a hashing round
+func workerCount() int {
+	if singleThread {
+		return 1
+	}
+	if workers > 0 {
+		return workers
+	}
+	return runtime.NumCPU()
+}
+
+// prehashFile hashes the first prehashBytes of a file
+func prehashFile(path string, hasher hash.Hash) (string, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher.Reset()
+	if _, err := io.CopyN(hasher, throttle(file), prehashBytes); err != nil && err != io.EOF {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// prehashCandidates runs a first round of the worker pool over the leading
+// bytes of the candidates larger than prehashBytes, and sets aside the files
+// whose size and leading bytes no other candidate shares. Smaller files, and
+// files that could not be read, go straight to the full hash.
+func prehashCandidates(files []*WalkedFile, newHash func() hash.Hash) (candidates, unique []*WalkedFile) {
+	var large []*WalkedFile
+	cached := cachedSizes(files)
+	for _, file := range files {
+		if size, ok := contentSize(file); ok && size > prehashBytes && !cached[size] {
+			large = append(large, file)
+		} else {
+			candidates = append(candidates, file)
+		}
+	}
+	partial := make([]string, len(large))
+	pool := dedup.NewPool(scanContext, workerCount(), streamBacklog, newHash, func(_ int, hasher hash.Hash, i int) {
+		sum, err := prehashFile(large[i].path(), hasher)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path":  large[i].path(),
+				"error": err,
+			}).Debug("Failed to prehash file")
+			return
+		}
+		partial[i] = sum
+	})
+	for i := range large {
+		if !pool.Send(i) {
+			break
+		}
+	}
+	_ = pool.Close()
+
+	type prehashKey struct {
+		size int64
+		sum  string
+	}
+	buckets := make(map[prehashKey][]*WalkedFile)
+	var keys []prehashKey
+	for i, file := range large {
+		if partial[i] == "" {
+			candidates = append(candidates, file)
+			continue
+		}
+		size, _ := contentSize(file)
+		key := prehashKey{size: size, sum: partial[i]}
+		if buckets[key] == nil {
+			keys = append(keys, key)
+		}
+		buckets[key] = append(buckets[key], file)
+	}
+	for _, key := range keys {
+		if len(buckets[key]) < 2 {
+			unique = append(unique, buckets[key]...)
+		} else {
+			candidates = append(candidates, buckets[key]...)
+		}
+	}
+	atomic.AddInt64(&fileCount, int64(len(unique)))
+	atomic.AddInt64(&scannedBytes, candidateBytes(unique))
+	log.WithFields(log.Fields{
+		"candidates": len(candidates),
+		"unique":     len(unique),
+	}).Debug("Prehashed candidates")
+	return candidates, unique
+}
@@ -1,8 +1,23 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"sync/atomic"
+	"time"
+)
+
+var (
+	progressFormat   = "text"
+	progressInterval = time.Second
+	hideProgress     bool
+	hashedBytes      int64
+	// running counts of the hashing phase: distinct hashes, and files whose
+	// hash was already seen
+	uniqueHashes   int64
+	duplicateFiles int64
 )
 
 type Progress struct {
@@ -10,20 +25,35 @@ type Progress struct {
 	pattern    string
 	previous   string
 	count      int64
+	out        io.Writer
+	// details, when set, is appended to the pattern
+	details func() string
+	// bytes the bytes processed out of totalBytes. When totalBytes is set
+	// the pattern shows them rather than the count.
+	bytes      int64
+	totalBytes int64
+	start      time.Time
 }
 
 func (pg *Progress) delete() {
 	if !*pg.notdisplay {
 		for j := 0; j <= len(pg.previous); j++ {
-			fmt.Print("\b")
+			fmt.Fprint(pg.out, "\b")
 		}
 	}
 }
 
 func (pg *Progress) displayToConsole() {
 	if !*pg.notdisplay {
-		pg.previous = fmt.Sprintf(pg.pattern, pg.count)
-		fmt.Print(pg.previous)
+		if pg.totalBytes > 0 {
+			pg.previous = pg.describeBytes()
+		} else {
+			pg.previous = fmt.Sprintf(pg.pattern, pg.count)
+		}
+		if pg.details != nil {
+			pg.previous += pg.details()
+		}
+		fmt.Fprint(pg.out, pg.previous)
 	}
 }
 
@@ -35,12 +65,155 @@ func (pg *Progress) increment() {
 	}
 }
 
+// trackBytes shows the bytes processed out of total instead of the count,
+// with the pattern taking the processed and total sizes and the percentage
+// done and time left.
+// The count is kept when there are no bytes to process.
+func (pg *Progress) trackBytes(pattern string, total int64) {
+	if total > 0 {
+		pg.pattern, pg.totalBytes, pg.start = pattern, total, time.Now()
+	}
+}
+
+func (pg *Progress) addBytes(n int64) {
+	atomic.AddInt64(&pg.bytes, n)
+	if !*pg.notdisplay {
+		pg.delete()
+		pg.displayToConsole()
+	}
+}
+
+// describeBytes formats the bytes processed, with the time left estimated
+// from the rate so far once a second went by
+func (pg *Progress) describeBytes() string {
+	done := atomic.LoadInt64(&pg.bytes)
+	status := fmt.Sprintf("%.0f%%", 100*float64(done)/float64(pg.totalBytes))
+	if elapsed := time.Since(pg.start); done > 0 && done < pg.totalBytes && elapsed >= time.Second {
+		left := time.Duration(float64(elapsed) * float64(pg.totalBytes-done) / float64(done))
+		status += fmt.Sprintf(", %s left", left.Round(time.Second))
+	}
+	return fmt.Sprintf(pg.pattern, formatSize(done), formatSize(pg.totalBytes), status)
+}
+
+// byteCounter adds the bytes read from a file to a progress, up to the size
+// of the file so that a file read twice is counted once. A nil counter
+// counts nothing.
+type byteCounter struct {
+	pg        *Progress
+	remaining int64
+}
+
+func newByteCounter(pg *Progress, size int64) *byteCounter {
+	if pg == nil || pg.totalBytes == 0 {
+		return nil
+	}
+	return &byteCounter{pg: pg, remaining: size}
+}
+
+func (c *byteCounter) wrap(r io.Reader) io.Reader {
+	if c == nil {
+		return r
+	}
+	return &countingReader{r: r, c: c}
+}
+
+func (c *byteCounter) add(n int64) {
+	if n > c.remaining {
+		n = c.remaining
+	}
+	if n > 0 {
+		c.remaining -= n
+		c.pg.addBytes(n)
+	}
+}
+
+// finish counts the bytes of the file that were not read, since it was
+// cached, skipped or failed, so that the progress reaches its total
+func (c *byteCounter) finish() {
+	if c != nil {
+		c.add(c.remaining)
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	c *byteCounter
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.c.add(int64(n))
+	return n, err
+}
+
+// hashDetails describes the duplication found so far by the hashing phase
+func hashDetails() string {
+	return fmt.Sprintf(" (%d unique hashes, %d duplicates)", atomic.LoadInt64(&uniqueHashes), atomic.LoadInt64(&duplicateFiles))
+}
+
 func creatProgress(pattern string, notdisplay *bool) (pg *Progress) {
 	pg = &Progress{
 		notdisplay: notdisplay,
 		pattern:    pattern,
 		previous:   "",
 		count:      0,
+		out:        statsOutput,
 	}
 	return pg
 }
+
+// progressEvent a machine readable progress update, emitted as NDJSON on
+// stderr with -progress-format json
+type progressEvent struct {
+	Type      string  `json:"type"`
+	Processed int64   `json:"processed"`
+	Total     int64   `json:"total,omitempty"`
+	Bytes     int64   `json:"bytes"`
+	Unique    int64   `json:"unique,omitempty"`
+	Duplicate int64   `json:"duplicates,omitempty"`
+	Elapsed   float64 `json:"elapsed"`
+}
+
+// startProgressEvents emits a progress event for pg every progress interval
+// until the returned function is called, which emits a last event.
+func startProgressEvents(pg *Progress, kind string, total int64) func() {
+	if progressFormat != "json" {
+		return func() {}
+	}
+	start := time.Now()
+	enc := json.NewEncoder(os.Stderr)
+	emit := func() {
+		event := progressEvent{
+			Type:      kind,
+			Processed: atomic.LoadInt64(&pg.count),
+			Total:     total,
+			Elapsed:   time.Since(start).Seconds(),
+		}
+		if kind == "hash" {
+			event.Bytes = atomic.LoadInt64(&hashedBytes)
+			event.Unique = atomic.LoadInt64(&uniqueHashes)
+			event.Duplicate = atomic.LoadInt64(&duplicateFiles)
+		}
+		_ = enc.Encode(event)
+	}
+	ticker := time.NewTicker(progressInterval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				emit()
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+		emit()
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"sync/atomic"
+)
+
+// RecordSplitter cuts a file into records that are hashed and grouped on
+// their own, for files concatenating many records such as mailboxes.
+type RecordSplitter interface {
+	// Split calls fn for every record of r with its offset and length in the
+	// file, and the part of the record that identifies its content.
+	Split(r io.Reader, fn func(offset, length int64, content []byte)) error
+}
+
+var recordSplitters = map[string]RecordSplitter{
+	"mbox": mboxSplitter{},
+}
+
+// mboxSplitter splits mailboxes on their "From " separator lines. The
+// separator holds the delivery date, so it is left out of the content: a
+// message delivered twice is still reported as a duplicate.
+type mboxSplitter struct{}
+
+func (mboxSplitter) Split(r io.Reader, fn func(offset, length int64, content []byte)) error {
+	reader := bufio.NewReaderSize(r, 1024*1024)
+	var (
+		record    bytes.Buffer
+		start     int64
+		offset    int64
+		separator int
+		blank     = true
+	)
+	flush := func() {
+		if record.Len() > 0 {
+			fn(start, int64(record.Len()), record.Bytes()[separator:])
+		}
+		record.Reset()
+	}
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if blank && bytes.HasPrefix(line, []byte("From ")) {
+				flush()
+				start, separator = offset, len(line)
+			}
+			record.Write(line)
+			offset += int64(len(line))
+			blank = len(bytes.TrimRight(line, "\r\n")) == 0
+		}
+		if err == io.EOF {
+			flush()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// recordLocation a record found in a scanned file
+type recordLocation struct {
+	path   string
+	offset int64
+	length int64
+}
+
+// findDuplicateRecords splits every walked file into records and returns
+// the groups of records sharing the same content, along with the number of
+// records seen. Records are hashed with the -hash digest, as whole files are.
+func findDuplicateRecords(splitter RecordSplitter, files []*WalkedFile, newHash func() hash.Hash) ([][]recordLocation, int) {
+	byHash := make(map[string][]recordLocation)
+	hasher := newHash()
+	records := 0
+	for _, walked := range files {
+		path := walked.path()
+		file, err := openFile(path)
+		if err != nil {
+			countFailure(path, err, "Failed to open file")
+			continue
+		}
+		atomic.AddInt64(&fileCount, 1)
+		atomic.AddInt64(&scannedBytes, memberSize(walked))
+		err = splitter.Split(throttle(file), func(offset, length int64, content []byte) {
+			hasher.Reset()
+			hasher.Write(content)
+			hash := fmt.Sprintf("%x", hasher.Sum(nil))
+			byHash[hash] = append(byHash[hash], recordLocation{path: path, offset: offset, length: length})
+			records++
+		})
+		_ = file.Close()
+		if err != nil {
+			countFailure(path, err, "Failed to split file into records")
+		}
+	}
+
+	var groups [][]recordLocation
+	for _, locations := range byHash {
+		if len(locations) > 1 {
+			groups = append(groups, locations)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i][0], groups[j][0]
+		return a.path < b.path || (a.path == b.path && a.offset < b.offset)
+	})
+	return groups, records
+}
+
+func writeRecordGroups(groups [][]recordLocation) {
+	for _, locations := range groups {
+		for _, location := range locations {
+			fmt.Fprintf(resultOutput, "%s offset %d length %d\n", displayPath(location.path), location.offset, location.length)
+		}
+		fmt.Fprintln(resultOutput, "---------")
+	}
+}
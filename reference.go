@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// referenceDir the absolute path of the -reference directory, whose
+	// files are only compared with those of the scanned roots
+	referenceDir string
+	// referenceRoot the index of the reference in roots, walked last
+	referenceRoot int32 = -1
+)
+
+func isReference(file *WalkedFile) bool {
+	return file.root == referenceRoot
+}
+
+// inReference reports whether a directory met while walking a scanned root
+// is the reference, left to its own walk so that its files are not taken
+// for files of the root.
+func inReference(path string, f os.FileInfo) bool {
+	if referenceRoot < 0 || currentRoot == referenceRoot || !f.IsDir() {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	return err == nil && abs == referenceDir
+}
+
+// referenceMatch a file of the scanned roots with a reference file holding
+// the same content
+type referenceMatch struct {
+	file, reference *WalkedFile
+}
+
+// referenceMatches pairs the files of the scanned roots with a reference
+// copy, the first in path order of their group. Groups within the reference
+// or within the roots only are left out.
+func referenceMatches(groups []*DuplicateGroup) []referenceMatch {
+	var matches []referenceMatch
+	for _, g := range groups {
+		var reference *WalkedFile
+		for _, file := range g.files {
+			if isReference(file) {
+				reference = file
+				break
+			}
+		}
+		if reference == nil {
+			continue
+		}
+		for _, file := range g.files {
+			if !isReference(file) {
+				matches = append(matches, referenceMatch{file, reference})
+			}
+		}
+	}
+	return matches
+}
+
+func writeReferenceMatches(root string, matches []referenceMatch) {
+	references := make(map[*WalkedFile]bool)
+	for _, m := range matches {
+		fmt.Fprintf(resultOutput, "%s duplicates reference %s\n", displayPath(m.file.path()), displayPath(m.reference.path()))
+		references[m.reference] = true
+	}
+	if !noStats {
+		fmt.Fprintf(statsOutput, "\nFound %d files in %s already in the reference %s, as %d reference files\n", len(matches), root, referenceDir, len(references))
+	}
+}
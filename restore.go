@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// restoreScript a shell script recreating the deleted duplicates from the
+// copies that were kept
+type restoreScript struct {
+	file *os.File
+}
+
+var restore *restoreScript
+
+func openRestoreScript(path string) (*restoreScript, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.WriteString("#!/bin/sh\n# Recreates the duplicates deleted by duplicates from the copies kept\n"); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &restoreScript{file: file}, nil
+}
+
+// add records how to recreate path from kept. Files deleted without a kept
+// copy, through -delete-hashes, can not be restored and are only listed.
+func (r *restoreScript) add(kept, path string) {
+	line := fmt.Sprintf("# no copy was kept of %s\n", shellQuote(absPath(path)))
+	if kept != "" {
+		line = fmt.Sprintf("cp -p -- %s %s\n", shellQuote(absPath(kept)), shellQuote(absPath(path)))
+	}
+	if _, err := r.file.WriteString(line); err != nil {
+		log.WithFields(log.Fields{
+			"path":  path,
+			"error": err,
+		}).Error("Failed to write the restore script")
+	}
+}
+
+// closeRestoreScript closes the -restore-script, if open, before the
+// program exits, which skips the deferred calls
+func closeRestoreScript() {
+	if restore != nil {
+		restore.close()
+		restore = nil
+	}
+}
+
+func (r *restoreScript) close() {
+	err := r.file.Sync()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to close the restore script")
+	}
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// shellQuote quotes s for a POSIX shell: single quotes keep every byte but
+// the single quote itself, which closes the quotes, is escaped, then reopens
+// them.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	phaseWalking int32 = iota
+	phaseHashing
+	phaseDone
+)
+
+var (
+	scanPhase  int32
+	phaseNames = []string{"walking", "hashing", "done"}
+)
+
+func setScanPhase(phase int32) {
+	atomic.StoreInt32(&scanPhase, phase)
+}
+
+func progressCount(pg *Progress) int64 {
+	if pg == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&pg.count)
+}
+
+func serveStatus(w http.ResponseWriter, r *http.Request) {
+	status := struct {
+		Phase   string `json:"phase"`
+		Visited int64  `json:"visited"`
+		Matched int64  `json:"matched"`
+		Hashed  int64  `json:"hashed"`
+	}{
+		Phase:   phaseNames[atomic.LoadInt32(&scanPhase)],
+		Visited: atomic.LoadInt64(&visitCount),
+		Matched: progressCount(walkProgress),
+		Hashed:  progressCount(hashProgress),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.WithError(err).Error("Failed to write status")
+	}
+}
+
+func serveResults(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(toJSONGroups(collectGroups())); err != nil {
+		log.WithError(err).Error("Failed to write results")
+	}
+}
+
+// startServer exposes the scan progress on /status and the duplicate groups
+// found so far on /results.
+func startServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", serveStatus)
+	mux.HandleFunc("/results", serveResults)
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("HTTP server failed")
+		}
+	}()
+	log.WithField("addr", addr).Info("Serving scan status")
+	return server
+}
+
+func stopServer(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.WithError(err).Error("Failed to stop HTTP server")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// groupSink streams the duplicate groups to a consumer as soon as they are
+// complete. Groups only gather files of the same size, so a group is known
+// to be complete once every walked file of its size has been hashed.
+type groupSink struct {
+	sync.Mutex
+	w       io.WriteCloser
+	enc     *json.Encoder
+	sizes   map[*WalkedFile]int64
+	pending map[int64]int
+	hashes  map[int64][]string
+	broken  bool
+}
+
+var sink *groupSink
+
+// openSink connects to a Unix socket or opens a named pipe for writing
+func openSink(path string) (*groupSink, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var w io.WriteCloser
+	if info.Mode()&os.ModeSocket != 0 {
+		w, err = net.Dial("unix", path)
+	} else {
+		w, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &groupSink{
+		w:       w,
+		enc:     json.NewEncoder(w),
+		sizes:   make(map[*WalkedFile]int64),
+		pending: make(map[int64]int),
+		hashes:  make(map[int64][]string),
+	}, nil
+}
+
+// sizeKey the size under which a file waits for its group to complete. When
+// files of different sizes may be grouped, everything waits for the end.
+func sizeKey(file *WalkedFile) int64 {
+	if approximateHashing() {
+		return 0
+	}
+	size, ok := contentSize(file)
+	if !ok {
+		return -1
+	}
+	return size
+}
+
+// expect registers the files about to be hashed
+func (s *groupSink) expect(files []*WalkedFile) {
+	s.Lock()
+	defer s.Unlock()
+	for _, file := range files {
+		key := sizeKey(file)
+		s.sizes[file] = key
+		s.pending[key]++
+	}
+}
+
+// hashed accounts for a hashed file, streaming the groups of its size when
+// it was the last one of that size.
+func (s *groupSink) hashed(file *WalkedFile, hash string) {
+	s.Lock()
+	defer s.Unlock()
+	key := s.sizes[file]
+	delete(s.sizes, file)
+	if hash != "" {
+		s.hashes[key] = append(s.hashes[key], hash)
+	}
+	if s.pending[key]--; s.pending[key] > 0 {
+		return
+	}
+	s.flush(key)
+}
+
+func (s *groupSink) flush(key int64) {
+	hashes := s.hashes[key]
+	delete(s.hashes, key)
+	delete(s.pending, key)
+	seen := make(map[string]bool)
+	for _, hash := range hashes {
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		duplicates.RLock()
+		files := duplicates.m[hash]
+		duplicates.RUnlock()
+		if len(files) < 2 {
+			continue
+		}
+		group := &DuplicateGroup{hash: hash, files: files}
+		if !verifyContent {
+			s.write(group)
+			continue
+		}
+		for _, part := range splitByContent(group) {
+			if len(part.files) > 1 {
+				s.write(part)
+			}
+		}
+	}
+}
+
+// write streams a group as -format json reports it, hard links collapsed
+// and paths resolved
+func (s *groupSink) write(g *DuplicateGroup) {
+	for _, group := range toJSONGroups(collapseHardLinks([]*DuplicateGroup{g})) {
+		if s.broken || len(group.Paths) < minCopies {
+			continue
+		}
+		if err := s.enc.Encode(group); err != nil {
+			// the consumer went away, keep scanning without it
+			log.WithError(err).Warn("Sink disconnected, no more groups are streamed")
+			s.broken = true
+		}
+	}
+}
+
+// close streams the groups still waiting, if any, and closes the sink
+func (s *groupSink) close() {
+	s.Lock()
+	defer s.Unlock()
+	for key := range s.pending {
+		s.flush(key)
+	}
+	if err := s.w.Close(); err != nil && !s.broken {
+		log.WithError(err).Warn("Failed to close the sink")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+func fileOwner(f os.FileInfo) (uid, gid uint32, ok bool) {
+	return 0, 0, false
+}
+
+// fileDevice returns the device holding a file
+func fileDevice(f os.FileInfo) (dev uint64, ok bool) {
+	return 0, false
+}
+
+// fileInode returns the device and inode numbers identifying a file
+func fileInode(f os.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+func fileOwner(f os.FileInfo) (uid, gid uint32, ok bool) {
+	stat, ok := f.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return stat.Uid, stat.Gid, true
+}
+
+// fileDevice returns the device holding a file
+func fileDevice(f os.FileInfo) (dev uint64, ok bool) {
+	stat, ok := f.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Dev), true
+}
+
+// fileInode returns the device and inode numbers identifying a file
+func fileInode(f os.FileInfo) (dev, ino uint64, ok bool) {
+	stat, ok := f.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(stat.Dev), uint64(stat.Ino), true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"hash"
+	"sync/atomic"
+
+	"duplicates/dedup"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// streamFiles hands the files found by the walk straight to the hashing
+// workers instead of collecting them into walkFiles first
+var streamFiles bool
+
+// streamBacklog the files waiting for a worker per worker, past which the
+// walk waits for the workers
+const streamBacklog = 64
+
+// hashStream a pool of workers hashing the files sent to it
+type hashStream struct {
+	pool  *dedup.Pool[*WalkedFile]
+	stats []workerStats
+	// sizes counts the files sent of each size, for completeGroups
+	sizes map[int64]int
+}
+
+// startHashStream starts the workers hashing the files sent to the stream,
+// through a channel of a fixed size so that the memory does not grow with
+// the number of files waiting. They stop with the scan when it is
+// interrupted.
+func startHashStream(progress *Progress, newHash func() hash.Hash) *hashStream {
+	numWorkers := workerCount()
+	s := &hashStream{stats: make([]workerStats, numWorkers), sizes: make(map[int64]int)}
+	log.WithField("workers", numWorkers).Debug("Starting workers")
+	s.pool = dedup.NewPool(scanContext, numWorkers, streamBacklog, newHash, func(id int, hasher hash.Hash, file *WalkedFile) {
+		hashWalkedFile(file, progress, hasher, &s.stats[id-1])
+	})
+	return s
+}
+
+// send queues a file, waiting while the workers are busy, and reports false
+// once the stream was stopped by an interruption.
+func (s *hashStream) send(file *WalkedFile) bool {
+	if !s.pool.Send(file) {
+		return false
+	}
+	s.sizes[memberSize(file)]++
+	return true
+}
+
+// close waits for the workers to hash the files sent, and returns the error
+// that stopped them if any
+func (s *hashStream) close() error {
+	err := s.pool.Close()
+	for i, stats := range s.stats {
+		log.WithFields(log.Fields{
+			"workerID":       i + 1,
+			"processedFiles": stats.processedFiles,
+			"totalBytes":     stats.totalBytes,
+			"errors":         stats.errors,
+		}).Debug("Worker finished")
+	}
+	return err
+}
+
+// streamDetails describes the hashing done while the walk goes on
+func streamDetails() string {
+	return fmt.Sprintf(" (%d hashed, %d unique hashes, %d duplicates)", progressCount(hashProgress), atomic.LoadInt64(&uniqueHashes), atomic.LoadInt64(&duplicateFiles))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// scanSummary the totals of a scan written by -summary-json, for dashboards
+// tracking them over time
+type scanSummary struct {
+	Files       int64   `json:"files"`
+	Bytes       int64   `json:"bytes"`
+	Groups      int64   `json:"groups"`
+	Redundant   int     `json:"redundant"`
+	Reclaimable int64   `json:"reclaimable"`
+	Elapsed     float64 `json:"elapsed"`
+	Errors      int64   `json:"errors"`
+	Interrupted bool    `json:"interrupted,omitempty"`
+}
+
+// writeSummary writes the totals of the scan to path: the files scanned and
+// their total size, whether they were hashed or proven unique beforehand,
+// and the errors from failedFiles.
+func writeSummary(path string, groups int64, redundant int, reclaimable int64) error {
+	summary := scanSummary{
+		Files:       atomic.LoadInt64(&fileCount),
+		Bytes:       atomic.LoadInt64(&scannedBytes),
+		Groups:      groups,
+		Redundant:   redundant,
+		Reclaimable: reclaimable,
+		Elapsed:     time.Since(scanStart).Seconds(),
+		Errors:      atomic.LoadInt64(&failedFiles),
+		Interrupted: interrupted(),
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
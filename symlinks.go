@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// followSymlinks walks the targets of the symbolic links met by the
+	// walk, which are otherwise skipped
+	followSymlinks bool
+	// visitedDirs the directories walked with -follow-symlinks, by inode, so
+	// that a link back to one of them is not walked again
+	visitedDirs = make(map[string]bool)
+)
+
+// firstVisit records a directory walked with -follow-symlinks and reports
+// whether it was not reached before, through a link or its own path.
+func firstVisit(path string, f os.FileInfo) bool {
+	key := path
+	if dev, ino, ok := fileInode(f); ok {
+		key = fmt.Sprintf("%d:%d", dev, ino)
+	} else if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		key = resolved
+	}
+	if visitedDirs[key] {
+		return false
+	}
+	visitedDirs[key] = true
+	return true
+}
+
+// visitSymlink visits the target of a symbolic link as if it was found at
+// the path of the link. A link to a file is a candidate holding the content
+// of its target, which collapseHardLinks folds with the target when both are
+// walked. A link to a directory has its target walked, unless the directory
+// was walked already so that links to a parent do not loop.
+func visitSymlink(path string) error {
+	target, err := os.Stat(path)
+	if err != nil {
+		log.WithError(err).WithField("path", path).Warn("Skipping broken symbolic link")
+		return nil
+	}
+	if !target.IsDir() {
+		return visitFile(path, target, nil)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		log.WithError(err).WithField("path", path).Warn("Skipping unresolvable symbolic link")
+		return nil
+	}
+	err = filepath.Walk(resolved, func(p string, f os.FileInfo, err error) error {
+		rel, relErr := filepath.Rel(resolved, p)
+		if relErr != nil {
+			return relErr
+		}
+		return visitFile(filepath.Join(path, rel), f, err)
+	})
+	if err == errMaxFiles || err == errInterrupted {
+		return err
+	}
+	if err != nil {
+		log.Errorln(err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+var (
+	niceMode    bool
+	loadPaused  int32
+	readLimiter *rate.Limiter
+	bytesRead   int64
+)
+
+// throttledReader holds back the reads of the hashing phase while the
+// system is too loaded, and keeps the reads of all the workers under the
+// -rate limit.
+type throttledReader struct {
+	r io.Reader
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	for atomic.LoadInt32(&loadPaused) == 1 {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if readLimiter != nil && len(p) > readLimiter.Burst() {
+		p = p[:readLimiter.Burst()]
+	}
+	n, err := t.r.Read(p)
+	if readLimiter != nil && n > 0 {
+		if werr := readLimiter.WaitN(context.Background(), n); werr != nil {
+			return n, werr
+		}
+	}
+	atomic.AddInt64(&bytesRead, int64(n))
+	return n, err
+}
+
+func throttle(r io.Reader) io.Reader {
+	if !niceMode && readLimiter == nil {
+		return r
+	}
+	return &throttledReader{r: r}
+}
+
+// setReadRate shares a token bucket of the given bytes per second between
+// all the workers. A rate such as "50MB/s" or "50MB" is accepted.
+func setReadRate(value string) error {
+	perSecond, err := parseSize(strings.TrimSuffix(value, "/s"))
+	if err != nil {
+		return err
+	}
+	if perSecond <= 0 {
+		return fmt.Errorf("the rate must be positive")
+	}
+	setReadLimit(perSecond)
+	return nil
+}
+
+// setReadLimit shares a token bucket of perSecond bytes between all the
+// workers, the bursts being at most 1MiB so that no read goes far over it.
+func setReadLimit(perSecond int64) {
+	burst := perSecond
+	if burst > 1024*1024 {
+		burst = 1024 * 1024
+	}
+	readLimiter = rate.NewLimiter(rate.Limit(perSecond), int(burst))
+}
+
+// readLoadAverage returns the one minute load average of the system
+func readLoadAverage() (float64, error) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	return parseLoadAverage(string(data))
+}
+
+// parseLoadAverage reads the one minute load average, the first field of
+// /proc/loadavg
+func parseLoadAverage(data string) (float64, error) {
+	fields := strings.Fields(data)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("/proc/loadavg is empty")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// startNiceMonitor pauses hashing whenever the load average goes above the
+// number of CPUs and resumes it once the load is back under it. The returned
+// function stops the monitoring.
+func startNiceMonitor() func() {
+	if !niceMode {
+		return func() {}
+	}
+	if _, err := readLoadAverage(); err != nil {
+		log.WithError(err).Warn("System load is not available, -nice is ignored")
+		return func() {}
+	}
+	threshold := float64(runtime.NumCPU())
+	ticker := time.NewTicker(time.Second)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				load, err := readLoadAverage()
+				if err != nil {
+					continue
+				}
+				paused := int32(0)
+				if load > threshold {
+					paused = 1
+				}
+				if atomic.SwapInt32(&loadPaused, paused) != paused {
+					log.WithField("load", load).Debug("Hashing throttled by system load")
+				}
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		atomic.StoreInt32(&loadPaused, 0)
+	}
+}
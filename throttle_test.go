@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestParseLoadAverage(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		want float64
+		ok   bool
+	}{
+		{"0.52 0.58 0.59 1/467 12345\n", 0.52, true},
+		{"12.00 8.00 4.00 3/900 1\n", 12, true},
+		{"", 0, false},
+		{"\n", 0, false},
+		{"load 1 2\n", 0, false},
+	} {
+		load, err := parseLoadAverage(tc.data)
+		if (err == nil) != tc.ok || load != tc.want {
+			t.Errorf("parseLoadAverage(%q) = %v, %v, want %v (ok %v)", tc.data, load, err, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// readReport loads the groups of a prior run, written either as the JSON
+// array of -format json or as the NDJSON stream of -sink.
+func readReport(path string) ([]jsonGroup, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(file)
+	var groups []jsonGroup
+	for {
+		var value json.RawMessage
+		if err := dec.Decode(&value); err == io.EOF {
+			return groups, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(value) > 0 && value[0] == '[' {
+			var array []jsonGroup
+			if err := json.Unmarshal(value, &array); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			groups = append(groups, array...)
+			continue
+		}
+		var group jsonGroup
+		if err := json.Unmarshal(value, &group); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		groups = append(groups, group)
+	}
+}
+
+// reportTotals returns the redundant copies and reclaimable bytes of a report
+func reportTotals(groups []jsonGroup) (redundant, reclaimable int64) {
+	for _, g := range groups {
+		if len(g.Paths) > 1 {
+			redundant += int64(len(g.Paths) - 1)
+			reclaimable += int64(len(g.Paths)-1) * g.Size
+		}
+	}
+	return redundant, reclaimable
+}
+
+func signedSize(bytes int64) string {
+	if bytes < 0 {
+		return "-" + formatSize(-bytes)
+	}
+	return "+" + formatSize(bytes)
+}
+
+// printTrend shows how duplication evolved across the reports of prior runs,
+// given from the oldest to the most recent.
+func printTrend(paths []string) error {
+	var previousGroups, previousReclaimable int64
+	for i, path := range paths {
+		groups, err := readReport(path)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		redundant, reclaimable := reportTotals(groups)
+		fmt.Printf("%s  %s: %d groups, %d redundant files, %s reclaimable", info.ModTime().Format("2006-01-02 15:04"), path, len(groups), redundant, formatSize(reclaimable))
+		if i > 0 {
+			fmt.Printf(" (%+d groups, %s)", int64(len(groups))-previousGroups, signedSize(reclaimable-previousReclaimable))
+		}
+		fmt.Println()
+		previousGroups, previousReclaimable = int64(len(groups)), reclaimable
+	}
+	return nil
+}
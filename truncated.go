@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// flagTruncated separates the members of a group whose size differs
+	// from the majority, as suspected truncated or corrupt copies
+	flagTruncated bool
+	// truncatedSuspects the members separated from each group
+	truncatedSuspects = make(map[*DuplicateGroup][]*WalkedFile)
+)
+
+func memberSize(file *WalkedFile) int64 {
+	if size, ok := contentSize(file); ok {
+		return size
+	}
+	return file.file.Size()
+}
+
+// majoritySize returns the size shared by most members of a group, the
+// larger one on ties since it is the most complete.
+func majoritySize(g *DuplicateGroup) int64 {
+	counts := make(map[int64]int)
+	var majority int64
+	for _, file := range g.files {
+		size := memberSize(file)
+		counts[size]++
+		if counts[size] > counts[majority] || (counts[size] == counts[majority] && size > majority) {
+			majority = size
+		}
+	}
+	return majority
+}
+
+// separateTruncated takes out of each group the members whose size differs
+// from the majority. Exact hashing never groups them, but approximate
+// hashing and -key without content do. The suspects are reported with
+// their group and never deleted, linked or moved, so a complete copy is
+// not removed in favor of a truncated one.
+func separateTruncated(groups []*DuplicateGroup) {
+	for _, g := range groups {
+		majority := majoritySize(g)
+		var kept []*WalkedFile
+		for _, file := range g.files {
+			if memberSize(file) == majority {
+				kept = append(kept, file)
+				continue
+			}
+			truncatedSuspects[g] = append(truncatedSuspects[g], file)
+			log.WithFields(log.Fields{
+				"path":     file.path(),
+				"size":     memberSize(file),
+				"majority": majority,
+			}).Warn("Suspected truncated or corrupt copy")
+		}
+		g.files = kept
+	}
+}
+
+// describeSuspect tells how the size of a suspect differs from its group
+func describeSuspect(g *DuplicateGroup, file *WalkedFile) string {
+	return fmt.Sprintf("suspected truncated or corrupt, %s instead of %s", formatSize(memberSize(file)), formatSize(memberSize(g.files[0])))
+}
+
+func printTruncated() {
+	suspects := 0
+	for _, files := range truncatedSuspects {
+		suspects += len(files)
+	}
+	fmt.Fprintf(statsOutput, "Flagged %d suspected truncated or corrupt copies\n", suspects)
+}
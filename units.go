@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits the units of formatSize: "binary" for powers of 1024 (KiB,
+// MiB...) or "si" for powers of 1000 (KB, MB...)
+var sizeUnits = "binary"
+
+// unitBase returns the base of the units in use and the suffix following
+// their prefix letter
+func unitBase() (int64, string) {
+	if sizeUnits == "si" {
+		return 1000, "B"
+	}
+	return 1024, "iB"
+}
+
+// formatSize renders a number of bytes in a human readable unit
+func formatSize(bytes int64) string {
+	unit, suffix := unitBase()
+	if bytes < unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	div, exp := unit, 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c%s", float64(bytes)/float64(div), "KMGTPE"[exp], suffix)
+}
+
+// parseSize reads a size such as "512", "64KB", "64KiB" or "1.5GB". KiB, MiB,
+// GiB and TiB are powers of 1024, while KB, MB, GB and TB follow -units.
+func parseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := 1.0
+	base, _ := unitBase()
+	for i, prefix := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(value, prefix+"IB") {
+			value = strings.TrimSuffix(value, prefix+"IB")
+			multiplier = math.Pow(1024, float64(i+1))
+			break
+		}
+		if strings.HasSuffix(value, prefix+"B") {
+			value = strings.TrimSuffix(value, prefix+"B")
+			multiplier = math.Pow(float64(base), float64(i+1))
+			break
+		}
+	}
+	value = strings.TrimSuffix(value, "B")
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	return int64(n * multiplier), nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// verifyContent compares the bytes of the files sharing a hash
+	verifyContent bool
+	// hashCollisions the groups whose members shared a hash but not their
+	// bytes
+	hashCollisions int64
+)
+
+// verifyGroups compares byte for byte the members of each group, splitting
+// the groups whose files do not all hold the same bytes and dropping the
+// files left alone. Unless hashing is approximate, such a split is a
+// collision of the hash, which is counted and logged.
+func verifyGroups(groups []*DuplicateGroup) []*DuplicateGroup {
+	var verified []*DuplicateGroup
+	for _, g := range groups {
+		parts := splitByContent(g)
+		if len(parts) > 1 && !approximateHashing() {
+			hashCollisions++
+			paths := make([]string, len(parts))
+			for i, part := range parts {
+				paths[i] = part.files[0].path()
+			}
+			log.WithFields(log.Fields{
+				"hash":  g.hash,
+				"paths": paths,
+			}).Warn("Hash collision: files share a hash but not their content")
+		}
+		for _, part := range parts {
+			if len(part.files) > 1 {
+				verified = append(verified, part)
+			}
+		}
+	}
+	return verified
+}
+
+// splitByContent splits a group into parts whose files hold the same bytes.
+// The first file of the group stays first in its part unless it can not be
+// read. A file that can not be read is counted as a failure and left out,
+// the others being compared with the next member of its part.
+func splitByContent(g *DuplicateGroup) []*DuplicateGroup {
+	var parts []*DuplicateGroup
+files:
+	for _, file := range g.files {
+		for i := 0; i < len(parts); {
+			part := parts[i]
+			same, failed, err := sameContent(part.files[0].path(), file.path())
+			if err != nil {
+				countFailure(failed, err, "Failed to verify file")
+				if failed == file.path() {
+					continue files
+				}
+				if part.files = part.files[1:]; len(part.files) == 0 {
+					parts = append(parts[:i], parts[i+1:]...)
+				}
+				continue
+			}
+			if same {
+				part.files = append(part.files, file)
+				continue files
+			}
+			i++
+		}
+		parts = append(parts, &DuplicateGroup{hash: g.hash, files: []*WalkedFile{file}, links: g.links})
+	}
+	return parts
+}
+
+// sameContent compares two files with buffered reads. On error it returns
+// the path of the file that could not be read.
+func sameContent(a, b string) (bool, string, error) {
+	fa, err := openFile(a)
+	if err != nil {
+		return false, a, err
+	}
+	defer fa.Close()
+	fb, err := openFile(b)
+	if err != nil {
+		return false, b, err
+	}
+	defer fb.Close()
+
+	ra := bufio.NewReaderSize(throttle(fa), 1024*1024)
+	rb := bufio.NewReaderSize(throttle(fb), 1024*1024)
+	bufA, bufB := make([]byte, 64*1024), make([]byte, 64*1024)
+	for {
+		na, errA := io.ReadFull(ra, bufA)
+		nb, errB := io.ReadFull(rb, bufB)
+		endA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		endB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		if errA != nil && !endA {
+			return false, a, errA
+		}
+		if errB != nil && !endB {
+			return false, b, errB
+		}
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, "", nil
+		}
+		if endA || endB {
+			return endA && endB, "", nil
+		}
+	}
+}
+
+func printVerification(groups int) {
+	fmt.Fprintf(statsOutput, "\nVerified %d groups byte for byte, %d hash collisions\n", groups, hashCollisions)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// walkedCopies writes files holding the given contents and returns them as
+// the walk would
+func walkedCopies(t *testing.T, contents ...string) []*WalkedFile {
+	t.Helper()
+	dir := t.TempDir()
+	var files []*WalkedFile
+	for i, content := range contents {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, newWalkedFile(path, info))
+	}
+	return files
+}
+
+func TestSplitByContentUnreadable(t *testing.T) {
+	log.SetLevel(log.PanicLevel)
+	defer log.SetLevel(log.InfoLevel)
+	for _, tc := range []struct {
+		name       string
+		contents   []string
+		unreadable int
+		want       [][]int
+	}{
+		{"first file unreadable", []string{"x", "x", "x"}, 0, [][]int{{1, 2}}},
+		{"middle file unreadable", []string{"x", "x", "x"}, 1, [][]int{{0, 2}}},
+		{"last file unreadable", []string{"x", "x", "x"}, 2, [][]int{{0, 1}}},
+		{"first copy of the second content unreadable", []string{"x", "y", "y", "x"}, 1, [][]int{{0, 3}, {2}}},
+	} {
+		atomic.StoreInt64(&failedFiles, 0)
+		files := walkedCopies(t, tc.contents...)
+		if err := os.Remove(files[tc.unreadable].path()); err != nil {
+			t.Fatal(err)
+		}
+		parts := splitByContent(&DuplicateGroup{hash: "h", files: files})
+		var got [][]int
+		for _, part := range parts {
+			var members []int
+			for _, file := range part.files {
+				for i := range files {
+					if files[i] == file {
+						members = append(members, i)
+					}
+				}
+			}
+			got = append(got, members)
+		}
+		if !equalParts(got, tc.want) {
+			t.Errorf("%s: parts %v, want %v", tc.name, got, tc.want)
+		}
+		if failed := atomic.LoadInt64(&failedFiles); failed != 1 {
+			t.Errorf("%s: %d failures counted, want 1", tc.name, failed)
+		}
+	}
+	atomic.StoreInt64(&failedFiles, 0)
+}
+
+func equalParts(a, b [][]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// walkers the number of directories read at once by the walk given by
+// -walkers, 0 for one per CPU
+var walkers int
+
+// maxDepth the levels of directories walked below each root given by
+// -max-depth, 0 for the entries of the root only and -1 for no limit
+var maxDepth = -1
+
+// walkMu serializes the calls to visitFile, which records the walk in
+// unguarded state, while the walkers read the directories concurrently
+var walkMu sync.Mutex
+
+func walkerCount() int {
+	if singleThread {
+		return 1
+	}
+	if walkers > 0 {
+		return walkers
+	}
+	return runtime.NumCPU()
+}
+
+// walkRoot calls visitFile for the root and every file and directory below
+// it, as filepath.Walk does. With more than one walker the directories are
+// read by a pool of goroutines, so that the latency of a networked file
+// system is paid for several directories at once, and the order of the
+// visits is no longer lexical. A single walker keeps filepath.Walk.
+func walkRoot(root string) error {
+	if walkerCount() == 1 {
+		return filepath.Walk(root, visitFile)
+	}
+	info, err := os.Lstat(root)
+	if err = visit(root, info, err); err != nil || info == nil || !info.IsDir() {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	q := &dirQueue{dirs: []walkedDir{{root, info}}, pending: 1}
+	q.cond = sync.NewCond(&q.Mutex)
+	var wg sync.WaitGroup
+	for w := 0; w < walkerCount(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir, ok := q.pop(); ok; dir, ok = q.pop() {
+				q.done(readWalkedDir(q, dir))
+			}
+		}()
+	}
+	wg.Wait()
+	return q.err
+}
+
+// checkRoot reports a root that does not exist or can not be read, before
+// the walk starts. A file is a valid root, being compared with the files of
+// the other roots, or with none when it is the only one.
+func checkRoot(root string) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return nil
+	}
+	dir, err := os.Open(root)
+	if err != nil {
+		return err
+	}
+	_, err = dir.Readdirnames(1)
+	_ = dir.Close()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// outermostRoots drops the roots given twice or lying inside another root,
+// by their absolute paths keys, whose files the walk would otherwise find
+// twice, each of them then looking like a duplicate of itself.
+func outermostRoots(roots, keys []string) ([]string, []string) {
+	var kept, keptKeys []string
+	for i, key := range keys {
+		nested := false
+		for j, other := range keys {
+			// of two equal roots the first one is kept
+			if i != j && underPath(key, other) && (key != other || j < i) {
+				if key != other {
+					log.WithFields(log.Fields{
+						"root":   roots[i],
+						"inside": roots[j],
+					}).Warn("Skipping a root walked as part of another one")
+				}
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			kept, keptKeys = append(kept, roots[i]), append(keptKeys, key)
+		}
+	}
+	return kept, keptKeys
+}
+
+// tooDeep reports whether a directory is beyond -max-depth, its entries
+// being deeper than the levels walked below the root.
+func tooDeep(path string) bool {
+	if maxDepth < 0 {
+		return false
+	}
+	rel, err := filepath.Rel(roots[currentRoot], path)
+	if err != nil || rel == "." {
+		return false
+	}
+	return strings.Count(rel, string(filepath.Separator)) >= maxDepth
+}
+
+func visit(path string, info os.FileInfo, err error) error {
+	walkMu.Lock()
+	defer walkMu.Unlock()
+	return visitFile(path, info, err)
+}
+
+// walkedDir a directory left to read by the walkers
+type walkedDir struct {
+	path string
+	info os.FileInfo
+}
+
+// dirQueue the directories found by the walkers and not read yet. pending
+// counts them along with those being read, the walk being over when none
+// is left or a visit stopped it.
+type dirQueue struct {
+	sync.Mutex
+	cond    *sync.Cond
+	dirs    []walkedDir
+	pending int
+	err     error
+}
+
+// pop waits for a directory to read, and reports false once the walk is
+// over.
+func (q *dirQueue) pop() (walkedDir, bool) {
+	q.Lock()
+	defer q.Unlock()
+	for len(q.dirs) == 0 && q.pending > 0 && q.err == nil {
+		q.cond.Wait()
+	}
+	if len(q.dirs) == 0 || q.err != nil {
+		return walkedDir{}, false
+	}
+	// the last found first, keeping the walk close to depth first
+	dir := q.dirs[len(q.dirs)-1]
+	q.dirs = q.dirs[:len(q.dirs)-1]
+	return dir, true
+}
+
+func (q *dirQueue) push(dir walkedDir) {
+	q.Lock()
+	q.dirs = append(q.dirs, dir)
+	q.pending++
+	q.Unlock()
+	q.cond.Signal()
+}
+
+// done records a directory read, and the error stopping the walk if any
+func (q *dirQueue) done(err error) {
+	q.Lock()
+	q.pending--
+	if err != nil && q.err == nil {
+		q.err = err
+	}
+	q.Unlock()
+	q.cond.Broadcast()
+}
+
+// readWalkedDir visits the entries of a directory, in lexical order, and
+// queues its subdirectories. As with filepath.Walk, a directory that can
+// not be read is visited again with the error, and SkipDir returned for a
+// file skips the rest of its directory.
+func readWalkedDir(q *dirQueue, dir walkedDir) error {
+	entries, err := os.ReadDir(dir.path)
+	if err != nil {
+		if err = visit(dir.path, dir.info, err); err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries {
+		path := filepath.Join(dir.path, entry.Name())
+		info, err := entry.Info()
+		if err == nil && info.IsDir() {
+			err = visit(path, info, nil)
+			if err == nil {
+				q.push(walkedDir{path, info})
+				continue
+			}
+			if err == filepath.SkipDir {
+				continue
+			}
+			return err
+		}
+		if err = visit(path, info, err); err == filepath.SkipDir {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
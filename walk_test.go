@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOutermostRoots(t *testing.T) {
+	for _, tc := range []struct {
+		keys []string
+		want []string
+	}{
+		{[]string{"/data", "/backup"}, []string{"/data", "/backup"}},
+		{[]string{"/data", "/data/sub"}, []string{"/data"}},
+		{[]string{"/data/sub", "/data"}, []string{"/data"}},
+		{[]string{"/data", "/data"}, []string{"/data"}},
+		{[]string{"/data/file.txt", "/data"}, []string{"/data"}},
+		// a shared prefix is not a parent
+		{[]string{"/data", "/database"}, []string{"/data", "/database"}},
+		{[]string{"/", "/data"}, []string{"/"}},
+	} {
+		roots, keys := outermostRoots(tc.keys, tc.keys)
+		if !reflect.DeepEqual(roots, tc.want) || !reflect.DeepEqual(keys, tc.want) {
+			t.Errorf("outermostRoots(%v) = %v, want %v", tc.keys, roots, tc.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// includeXattr makes the extended attributes of files part of their hash
+var includeXattr bool
+
+// hashXattrs writes the extended attributes of a file to its hash, sorted
+// by name, each name and value preceded by its length so that no two sets of
+// attributes write the same bytes.
+func hashXattrs(w io.Writer, path string) error {
+	attrs, err := fileXattrs(path)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var length [8]byte
+	for _, name := range names {
+		for _, field := range [][]byte{[]byte(name), attrs[name]} {
+			binary.BigEndian.PutUint64(length[:], uint64(len(field)))
+			if _, err := w.Write(length[:]); err != nil {
+				return err
+			}
+			if _, err := w.Write(field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
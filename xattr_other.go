@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+const xattrSupported = false
+
+func fileXattrs(path string) (map[string][]byte, error) {
+	return nil, errors.New("extended attributes are not supported on this platform")
+}
@@ -0,0 +1,44 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"bytes"
+
+	"golang.org/x/sys/unix"
+)
+
+const xattrSupported = true
+
+// fileXattrs returns the extended attributes of a file by name. Symbolic
+// links are followed, like the content they are hashed with. A file system
+// without extended attributes, some tmpfs, FAT or NFS mounts, gives none.
+func fileXattrs(path string) (map[string][]byte, error) {
+	size, err := unix.Listxattr(path, nil)
+	if err == unix.ENOTSUP || err == unix.EOPNOTSUPP {
+		return nil, nil
+	}
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	list := make([]byte, size)
+	if size, err = unix.Listxattr(path, list); err != nil {
+		return nil, err
+	}
+	attrs := make(map[string][]byte)
+	for _, name := range bytes.Split(list[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		valueSize, err := unix.Getxattr(path, string(name), nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, valueSize)
+		if valueSize, err = unix.Getxattr(path, string(name), value); err != nil {
+			return nil, err
+		}
+		attrs[string(name)] = value[:valueSize]
+	}
+	return attrs, nil
+}